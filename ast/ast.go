@@ -2,6 +2,7 @@ package ast
 
 import (
 	"bytes"
+	"fmt"
 	"strings"
 
 	"waiacig/token"
@@ -22,6 +23,13 @@ type Expression interface {
 	expressionNode()
 }
 
+// Pattern is the left-hand side of a match arm: a literal, an identifier to
+// bind (`_` binds nothing), or an array or hash pattern made of patterns.
+type Pattern interface {
+	Node
+	patternNode()
+}
+
 type Program struct {
 	Statements []Statement
 }
@@ -43,9 +51,11 @@ func (p *Program) String() string {
 }
 
 type LetStatement struct {
-	Token token.Token
-	Name  *Identifier
-	Value Expression
+	Token   token.Token
+	Name    *Identifier
+	Pattern Pattern // set instead of Name when destructuring
+	Value   Expression
+	Const   bool // the binding can't be assigned to
 }
 
 func (ls *LetStatement) statementNode() {}
@@ -56,7 +66,11 @@ func (ls *LetStatement) TokenLiteral() string {
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString(ls.TokenLiteral() + " ")
-	out.WriteString(ls.Name.String())
+	if ls.Pattern != nil {
+		out.WriteString(ls.Pattern.String())
+	} else {
+		out.WriteString(ls.Name.String())
+	}
 	out.WriteString(" = ")
 	if ls.Value != nil {
 		out.WriteString(ls.Value.String())
@@ -65,12 +79,25 @@ func (ls *LetStatement) String() string {
 	return out.String()
 }
 
+// FunctionStatement declares a named function. Declarations are hoisted:
+// all the functions declared in a block are bound before it runs.
+type FunctionStatement struct {
+	Token    token.Token // the 'fn' token
+	Name     *Identifier
+	Function *FunctionLiteral
+}
+
+func (fs *FunctionStatement) statementNode()       {}
+func (fs *FunctionStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *FunctionStatement) String() string       { return fs.Function.String() }
+
 type Identifier struct {
 	Token token.Token
 	Value string
 }
 
 func (i *Identifier) expressionNode() {}
+func (i *Identifier) patternNode()    {}
 
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
 
@@ -96,6 +123,17 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+type ThrowStatement struct {
+	Token token.Token // the 'throw' token
+	Value Expression
+}
+
+func (ts *ThrowStatement) statementNode()       {}
+func (ts *ThrowStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *ThrowStatement) String() string {
+	return ts.TokenLiteral() + " " + ts.Value.String() + ";"
+}
+
 type ExpressionStatement struct {
 	Token      token.Token
 	Expression Expression
@@ -120,6 +158,7 @@ type IntegerLiteral struct {
 }
 
 func (il *IntegerLiteral) expressionNode() {}
+func (il *IntegerLiteral) patternNode()    {}
 
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
 
@@ -171,6 +210,7 @@ type Boolean struct {
 }
 
 func (b *Boolean) expressionNode() {}
+func (b *Boolean) patternNode()    {}
 
 func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
 
@@ -202,6 +242,36 @@ func (ife *IfExpression) String() string {
 	return out.String()
 }
 
+// TryExpression evaluates to the value of Block, or of Catch when Block
+// raises an error. Finally, if present, runs however either of them ends.
+type TryExpression struct {
+	Token   token.Token // the 'try' token
+	Block   *BlockStatement
+	Param   *Identifier // bound to the caught error; may be nil
+	Catch   *BlockStatement
+	Finally *BlockStatement
+}
+
+func (te *TryExpression) expressionNode()      {}
+func (te *TryExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("try ")
+	out.WriteString(te.Block.String())
+	if te.Catch != nil {
+		out.WriteString(" catch ")
+		if te.Param != nil {
+			out.WriteString("(" + te.Param.String() + ") ")
+		}
+		out.WriteString(te.Catch.String())
+	}
+	if te.Finally != nil {
+		out.WriteString(" finally ")
+		out.WriteString(te.Finally.String())
+	}
+	return out.String()
+}
+
 type BlockStatement struct {
 	Token      token.Token // the { token Statements []Statement
 	Statements []Statement
@@ -222,7 +292,19 @@ func (bs *BlockStatement) String() string {
 type FunctionLiteral struct {
 	Token      token.Token // The 'fn' token
 	Parameters []*Identifier
-	Body       *BlockStatement
+	// Patterns holds, for each parameter that is destructured, the pattern
+	// its argument is matched against. Entries for plain parameters are nil.
+	Patterns []Pattern
+	// Defaults holds, for each parameter, the expression evaluated when the
+	// call supplies no argument for it. Entries for required parameters are
+	// nil.
+	Defaults []Expression
+	Rest     *Identifier // collects extra arguments; nil unless variadic
+	Body     *BlockStatement
+	Name     string // set when the function is declared with a name
+	// IsGenerator is set when the body yields, making the function return
+	// a generator instead of running when called.
+	IsGenerator bool
 }
 
 func (fl *FunctionLiteral) expressionNode() {}
@@ -234,11 +316,21 @@ func (fl *FunctionLiteral) TokenLiteral() string {
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 	params := []string{}
-	for _, p := range fl.Parameters {
+	for i, p := range fl.Parameters {
+		if i < len(fl.Defaults) && fl.Defaults[i] != nil {
+			params = append(params, p.String()+" = "+fl.Defaults[i].String())
+			continue
+		}
 		params = append(params, p.String())
 	}
+	if fl.Rest != nil {
+		params = append(params, "..."+fl.Rest.String())
+	}
 
 	out.WriteString(fl.TokenLiteral())
+	if fl.Name != "" {
+		out.WriteString(" " + fl.Name)
+	}
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") ")
@@ -269,15 +361,68 @@ func (ce *CallExpression) String() string {
 	return out.String()
 }
 
+// YieldExpression hands a value to the caller of a generator's next and
+// suspends the generator until it is asked for another. With Delegate set,
+// as in 'yield* xs', it yields every value of the iterator xs in turn.
+type YieldExpression struct {
+	Token    token.Token // the 'yield' token
+	Value    Expression
+	Delegate bool
+}
+
+func (ye *YieldExpression) expressionNode()      {}
+func (ye *YieldExpression) TokenLiteral() string { return ye.Token.Literal }
+func (ye *YieldExpression) String() string {
+	if ye.Delegate {
+		return "yield* " + ye.Value.String()
+	}
+	return "yield " + ye.Value.String()
+}
+
+// SpreadElement expands an array into the surrounding array literal or
+// argument list, as in [0, ...xs] or f(...args).
+type SpreadElement struct {
+	Token token.Token // The '...' token
+	Value Expression
+}
+
+func (se *SpreadElement) expressionNode()      {}
+func (se *SpreadElement) TokenLiteral() string { return se.Token.Literal }
+func (se *SpreadElement) String() string       { return "..." + se.Value.String() }
+
+// KeywordArgument passes an argument by parameter name, as in f(x, y: 2).
+type KeywordArgument struct {
+	Token token.Token // The name token
+	Name  *Identifier
+	Value Expression
+}
+
+func (ka *KeywordArgument) expressionNode()      {}
+func (ka *KeywordArgument) TokenLiteral() string { return ka.Token.Literal }
+func (ka *KeywordArgument) String() string {
+	return ka.Name.String() + ": " + ka.Value.String()
+}
+
 type StringLiteral struct {
 	Token token.Token
 	Value string
 }
 
 func (sl *StringLiteral) expressionNode()      {}
+func (sl *StringLiteral) patternNode()         {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
 func (sl *StringLiteral) String() string       { return sl.Token.Literal }
 
+// RegexLiteral is a pattern between slashes, '/[a-z]+/'.
+type RegexLiteral struct {
+	Token   token.Token
+	Pattern string
+}
+
+func (rl *RegexLiteral) expressionNode()      {}
+func (rl *RegexLiteral) TokenLiteral() string { return rl.Token.Literal }
+func (rl *RegexLiteral) String() string       { return "/" + rl.Pattern + "/" }
+
 type ArrayLiteral struct {
 	Token    token.Token // the '[' token
 	Elements []Expression
@@ -297,6 +442,91 @@ func (al *ArrayLiteral) String() string {
 	return out.String()
 }
 
+// AssignExpression is 'Target = Value', where Target is an identifier or
+// an index expression.
+type AssignExpression struct {
+	Token  token.Token // The = token
+	Target Expression
+	Value  Expression
+}
+
+func (ae *AssignExpression) expressionNode()      {}
+func (ae *AssignExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae *AssignExpression) String() string {
+	return "(" + ae.Target.String() + " = " + ae.Value.String() + ")"
+}
+
+// SliceExpression is 'Left[Start:End:Step]'. Bounds that are left out are
+// nil.
+type SliceExpression struct {
+	Token token.Token // The [ token
+	Left  Expression
+	Start Expression
+	End   Expression
+	Step  Expression
+}
+
+func (se *SliceExpression) expressionNode()      {}
+func (se *SliceExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SliceExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(se.Left.String())
+	out.WriteString("[")
+	if se.Start != nil {
+		out.WriteString(se.Start.String())
+	}
+	out.WriteString(":")
+	if se.End != nil {
+		out.WriteString(se.End.String())
+	}
+	if se.Step != nil {
+		out.WriteString(":")
+		out.WriteString(se.Step.String())
+	}
+	out.WriteString("])")
+	return out.String()
+}
+
+// RangeExpression is 'Start..End', the integers from Start up to End.
+type RangeExpression struct {
+	Token token.Token // The .. token
+	Start Expression
+	End   Expression
+}
+
+func (re *RangeExpression) expressionNode()      {}
+func (re *RangeExpression) TokenLiteral() string { return re.Token.Literal }
+func (re *RangeExpression) String() string {
+	return "(" + re.Start.String() + ".." + re.End.String() + ")"
+}
+
+// ImportExpression evaluates to the module in the file Path refers to.
+type ImportExpression struct {
+	Token token.Token // The import token
+	Path  string
+}
+
+func (ie *ImportExpression) expressionNode()      {}
+func (ie *ImportExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *ImportExpression) String() string {
+	return fmt.Sprintf("import(%q)", ie.Path)
+}
+
+// MethodExpression is the function of a method call 'obj.name(args)'. The
+// call passes obj as the method's first argument.
+type MethodExpression struct {
+	Token  token.Token // The . token
+	Object Expression
+	Name   *Identifier
+}
+
+func (me *MethodExpression) expressionNode()      {}
+func (me *MethodExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MethodExpression) String() string {
+	return me.Object.String() + "." + me.Name.String()
+}
+
 type IndexExpression struct {
 	Token token.Token // The [ token
 	Left  Expression
@@ -322,6 +552,7 @@ func (ie *IndexExpression) String() string {
 type HashLiteral struct {
 	Token token.Token // the '{' token
 	Pairs map[Expression]Expression
+	Keys  []Expression // the keys of Pairs in source order
 }
 
 func (hl *HashLiteral) expressionNode()      {}
@@ -329,12 +560,12 @@ func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
 func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 	pairs := []string{}
-	for key, value := range hl.Pairs {
-		pairs = append(pairs, key.String()+":"+value.String())
-		out.WriteString("{")
-		out.WriteString(strings.Join(pairs, ", "))
-		out.WriteString("}")
+	for _, key := range hl.Keys {
+		pairs = append(pairs, key.String()+":"+hl.Pairs[key].String())
 	}
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
 	return out.String()
 }
 
@@ -362,3 +593,86 @@ func (ml *MacroLiteral) String() string {
 
 	return out.String()
 }
+
+type ArrayPattern struct {
+	Token    token.Token // the '[' token
+	Elements []Pattern
+	Rest     *Identifier // bound to the remaining elements, if set
+}
+
+func (ap *ArrayPattern) patternNode()         {}
+func (ap *ArrayPattern) TokenLiteral() string { return ap.Token.Literal }
+func (ap *ArrayPattern) String() string {
+	var out bytes.Buffer
+	elements := []string{}
+	for _, el := range ap.Elements {
+		elements = append(elements, el.String())
+	}
+	if ap.Rest != nil {
+		elements = append(elements, "..."+ap.Rest.String())
+	}
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+	return out.String()
+}
+
+type HashPattern struct {
+	Token  token.Token  // the '{' token
+	Keys   []Expression // literal keys, in source order
+	Values []Pattern
+}
+
+func (hp *HashPattern) patternNode()         {}
+func (hp *HashPattern) TokenLiteral() string { return hp.Token.Literal }
+func (hp *HashPattern) String() string {
+	var out bytes.Buffer
+	pairs := []string{}
+	for i, key := range hp.Keys {
+		pairs = append(pairs, key.String()+": "+hp.Values[i].String())
+	}
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+	return out.String()
+}
+
+type MatchArm struct {
+	Pattern Pattern
+	Guard   Expression // optional `if` condition
+	Body    Expression
+}
+
+func (ma *MatchArm) String() string {
+	var out bytes.Buffer
+	out.WriteString(ma.Pattern.String())
+	if ma.Guard != nil {
+		out.WriteString(" if ")
+		out.WriteString(ma.Guard.String())
+	}
+	out.WriteString(" => ")
+	out.WriteString(ma.Body.String())
+	return out.String()
+}
+
+type MatchExpression struct {
+	Token   token.Token // The 'match' token
+	Subject Expression
+	Arms    []*MatchArm
+}
+
+func (me *MatchExpression) expressionNode()      {}
+func (me *MatchExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MatchExpression) String() string {
+	var out bytes.Buffer
+	arms := []string{}
+	for _, arm := range me.Arms {
+		arms = append(arms, arm.String())
+	}
+	out.WriteString("match (")
+	out.WriteString(me.Subject.String())
+	out.WriteString(") { ")
+	out.WriteString(strings.Join(arms, ", "))
+	out.WriteString(" }")
+	return out.String()
+}
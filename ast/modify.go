@@ -18,6 +18,23 @@ func Modify(node Node, modifier ModifierFunc) Node {
 	case *IndexExpression:
 		node.Left, _ = Modify(node.Left, modifier).(Expression)
 		node.Index, _ = Modify(node.Index, modifier).(Expression)
+	case *SliceExpression:
+		node.Left, _ = Modify(node.Left, modifier).(Expression)
+		if node.Start != nil {
+			node.Start, _ = Modify(node.Start, modifier).(Expression)
+		}
+		if node.End != nil {
+			node.End, _ = Modify(node.End, modifier).(Expression)
+		}
+		if node.Step != nil {
+			node.Step, _ = Modify(node.Step, modifier).(Expression)
+		}
+	case *AssignExpression:
+		node.Target, _ = Modify(node.Target, modifier).(Expression)
+		node.Value, _ = Modify(node.Value, modifier).(Expression)
+	case *RangeExpression:
+		node.Start, _ = Modify(node.Start, modifier).(Expression)
+		node.End, _ = Modify(node.End, modifier).(Expression)
 	case *IfExpression:
 		node.Condition, _ = Modify(node.Condition, modifier).(Expression)
 		node.Consequence, _ = Modify(node.Consequence, modifier).(*BlockStatement)
@@ -28,25 +45,61 @@ func Modify(node Node, modifier ModifierFunc) Node {
 		for i, _ := range node.Statements {
 			node.Statements[i], _ = Modify(node.Statements[i], modifier).(Statement)
 		}
+	case *ThrowStatement:
+		node.Value, _ = Modify(node.Value, modifier).(Expression)
+	case *TryExpression:
+		node.Block, _ = Modify(node.Block, modifier).(*BlockStatement)
+		if node.Catch != nil {
+			node.Catch, _ = Modify(node.Catch, modifier).(*BlockStatement)
+		}
+		if node.Finally != nil {
+			node.Finally, _ = Modify(node.Finally, modifier).(*BlockStatement)
+		}
 	case *ReturnStatement:
 		node.ReturnValue, _ = Modify(node.ReturnValue, modifier).(Expression)
 	case *LetStatement:
 		node.Value, _ = Modify(node.Value, modifier).(Expression)
+	case *FunctionStatement:
+		node.Function, _ = Modify(node.Function, modifier).(*FunctionLiteral)
 	case *FunctionLiteral:
 		for i, _ := range node.Parameters {
 			node.Parameters[i], _ = Modify(node.Parameters[i], modifier).(*Identifier)
 		}
+		for i, def := range node.Defaults {
+			if def != nil {
+				node.Defaults[i], _ = Modify(def, modifier).(Expression)
+			}
+		}
 		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
     case *ArrayLiteral:
         for i, _ := range node.Elements {
             node.Elements[i], _ = Modify(node.Elements[i], modifier).(Expression)
 		}
+	case *YieldExpression:
+		node.Value, _ = Modify(node.Value, modifier).(Expression)
+	case *SpreadElement:
+		node.Value, _ = Modify(node.Value, modifier).(Expression)
+	case *KeywordArgument:
+		node.Value, _ = Modify(node.Value, modifier).(Expression)
+	case *MatchExpression:
+		node.Subject, _ = Modify(node.Subject, modifier).(Expression)
+		for _, arm := range node.Arms {
+			if arm.Guard != nil {
+				arm.Guard, _ = Modify(arm.Guard, modifier).(Expression)
+			}
+			arm.Body, _ = Modify(arm.Body, modifier).(Expression)
+		}
 	case *HashLiteral:
         newPairs := make(map[Expression]Expression)
+        newKeys := make(map[Expression]Expression)
         for key, val := range node.Pairs {
             newKey, _ := Modify(key, modifier).(Expression)
             newVal, _ := Modify(val, modifier).(Expression)
             newPairs[newKey] = newVal
+            newKeys[key] = newKey
+        }
+        for i, key := range node.Keys {
+            node.Keys[i] = newKeys[key]
         }
         node.Pairs = newPairs
 	}
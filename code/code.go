@@ -40,6 +40,32 @@ const (
 	OpGetBuiltin
 	OpClosure
 	OpGetFree
+	OpTailCall
+	OpMatchValue
+	OpMatchArray
+	OpMatchHash
+	OpMatchKey
+	OpArrayRest
+	OpNoMatch
+	OpDestructureError
+	OpJumpIfBound
+	OpSpread
+	OpApply
+	OpTry
+	OpEndTry
+	OpThrow
+	OpYield
+	OpSuspend
+	OpIterate
+	OpMethod
+	OpImport
+	OpSlice
+	OpRange
+	OpSetIndex
+	OpPatchFree
+	OpUnset
+	OpCheckSet
+	OpTailApply
 )
 
 type Definition struct {
@@ -48,35 +74,61 @@ type Definition struct {
 }
 
 var definitions = map[Opcode]*Definition{
-	OpConstant:      {"OpConstant", []int{2}},
-	OpAdd:           {"OpAdd", []int{}},
-	OpPop:           {"OpPop", []int{}},
-	OpSub:           {"OpSub", []int{}},
-	OpMul:           {"OpMul", []int{}},
-	OpDiv:           {"OpDiv", []int{}},
-	OpTrue:          {"OpTrue", []int{}},
-	OpFalse:         {"OpFalse", []int{}},
-	OpEqual:         {"OpEqual", []int{}},
-	OpNotEqual:      {"OpNotEqual", []int{}},
-	OpGreaterThan:   {"OpGreaterThan", []int{}},
-	OpMinus:         {"OpMinus", []int{}},
-	OpBang:          {"OpBang", []int{}},
-	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
-	OpJump:          {"OpJump", []int{2}},
-	OpNull:          {"OpNull", []int{}},
-	OpGetGlobal:     {"OpGetGlobal", []int{2}},
-	OpSetGlobal:     {"OpSetGlobal", []int{2}},
-	OpArray:         {"OpArray", []int{2}},
-	OpHash:          {"OpHash", []int{2}},
-	OpIndex:         {"OpIndex", []int{}},
-	OpCall:          {"OpCall", []int{1}},
-	OpReturnValue:   {"OpReturnValue", []int{}},
-	OpReturn:        {"OpReturn", []int{}},
-	OpGetLocal:      {"OpGetLocal", []int{1}},
-	OpSetLocal:      {"OpSetLocal", []int{1}},
-	OpGetBuiltin:    {"OpGetBuiltin", []int{1}},
-	OpClosure:       {"OpClosure", []int{2, 1}},
-	OpGetFree:       {"OpGetFree", []int{1}},
+	OpConstant:         {"OpConstant", []int{2}},
+	OpAdd:              {"OpAdd", []int{}},
+	OpPop:              {"OpPop", []int{}},
+	OpSub:              {"OpSub", []int{}},
+	OpMul:              {"OpMul", []int{}},
+	OpDiv:              {"OpDiv", []int{}},
+	OpTrue:             {"OpTrue", []int{}},
+	OpFalse:            {"OpFalse", []int{}},
+	OpEqual:            {"OpEqual", []int{}},
+	OpNotEqual:         {"OpNotEqual", []int{}},
+	OpGreaterThan:      {"OpGreaterThan", []int{}},
+	OpMinus:            {"OpMinus", []int{}},
+	OpBang:             {"OpBang", []int{}},
+	OpJumpNotTruthy:    {"OpJumpNotTruthy", []int{2}},
+	OpJump:             {"OpJump", []int{2}},
+	OpNull:             {"OpNull", []int{}},
+	OpGetGlobal:        {"OpGetGlobal", []int{2}},
+	OpSetGlobal:        {"OpSetGlobal", []int{2}},
+	OpArray:            {"OpArray", []int{2}},
+	OpHash:             {"OpHash", []int{2}},
+	OpIndex:            {"OpIndex", []int{}},
+	OpCall:             {"OpCall", []int{1}},
+	OpReturnValue:      {"OpReturnValue", []int{}},
+	OpReturn:           {"OpReturn", []int{}},
+	OpGetLocal:         {"OpGetLocal", []int{1}},
+	OpSetLocal:         {"OpSetLocal", []int{1}},
+	OpGetBuiltin:       {"OpGetBuiltin", []int{2}},
+	OpClosure:          {"OpClosure", []int{2, 1}},
+	OpGetFree:          {"OpGetFree", []int{1}},
+	OpTailCall:         {"OpTailCall", []int{1}},
+	OpMatchValue:       {"OpMatchValue", []int{}},
+	OpMatchArray:       {"OpMatchArray", []int{2, 1}},
+	OpMatchHash:        {"OpMatchHash", []int{}},
+	OpMatchKey:         {"OpMatchKey", []int{}},
+	OpArrayRest:        {"OpArrayRest", []int{2}},
+	OpNoMatch:          {"OpNoMatch", []int{}},
+	OpDestructureError: {"OpDestructureError", []int{2}},
+	OpJumpIfBound:      {"OpJumpIfBound", []int{1, 2}},
+	OpSpread:           {"OpSpread", []int{}},
+	OpApply:            {"OpApply", []int{1}},
+	OpTry:              {"OpTry", []int{2}},
+	OpEndTry:           {"OpEndTry", []int{}},
+	OpThrow:            {"OpThrow", []int{}},
+	OpYield:            {"OpYield", []int{}},
+	OpSuspend:          {"OpSuspend", []int{}},
+	OpIterate:          {"OpIterate", []int{2}},
+	OpMethod:           {"OpMethod", []int{}},
+	OpImport:           {"OpImport", []int{2}},
+	OpSlice:            {"OpSlice", []int{}},
+	OpRange:            {"OpRange", []int{}},
+	OpSetIndex:         {"OpSetIndex", []int{}},
+	OpPatchFree:        {"OpPatchFree", []int{1}},
+	OpUnset:            {"OpUnset", []int{2}},
+	OpCheckSet:         {"OpCheckSet", []int{}},
+	OpTailApply:        {"OpTailApply", []int{1}},
 }
 
 func Lookup(op byte) (*Definition, error) {
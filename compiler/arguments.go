@@ -0,0 +1,110 @@
+package compiler
+
+import (
+	"fmt"
+	"waiacig/ast"
+	"waiacig/code"
+	"waiacig/object"
+)
+
+// compileDefaults emits the prologue that fills in parameters the caller
+// left without an argument. The VM leaves such parameters unbound, so each
+// default is only evaluated when its slot is still empty.
+func (c *Compiler) compileDefaults(fn *ast.FunctionLiteral) error {
+	for i, def := range fn.Defaults {
+		if def == nil {
+			continue
+		}
+		jumpPos := c.emit(code.OpJumpIfBound, i, 9999)
+		err := c.Compile(def)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpSetLocal, i)
+		afterDefault := len(c.currentInstructions())
+		c.replaceInstruction(jumpPos, code.MakeInstruction(code.OpJumpIfBound, i, afterDefault))
+	}
+	return nil
+}
+
+func countDefaults(fn *ast.FunctionLiteral) int {
+	n := 0
+	for _, def := range fn.Defaults {
+		if def != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func parameterNames(fn *ast.FunctionLiteral) []string {
+	names := make([]string, len(fn.Parameters))
+	for i, p := range fn.Parameters {
+		names[i] = p.Value
+	}
+	return names
+}
+
+// receivers is 1 for a method call, whose OpMethod leaves the receiver on
+// the stack after the method as its first argument, and 0 otherwise.
+func receivers(call *ast.CallExpression) int {
+	if _, ok := call.Function.(*ast.MethodExpression); ok {
+		return 1
+	}
+	return 0
+}
+
+// needsApply reports whether a call spreads or names any of its arguments,
+// which OpCall can't express.
+func needsApply(call *ast.CallExpression) bool {
+	for _, arg := range call.Arguments {
+		switch arg.(type) {
+		case *ast.SpreadElement, *ast.KeywordArgument:
+			return true
+		}
+	}
+	return false
+}
+
+// compileApply compiles a call with spread or keyword arguments. The
+// positional arguments are collected into an array, with spread elements
+// flattened into it, followed by a name and value for every keyword
+// argument; OpApply then lays them out for the callee, or OpTailApply for a
+// call in tail position.
+func (c *Compiler) compileApply(call *ast.CallExpression) error {
+	err := c.Compile(call.Function)
+	if err != nil {
+		return err
+	}
+	positional := 0
+	for _, arg := range call.Arguments {
+		if _, ok := arg.(*ast.KeywordArgument); ok {
+			break
+		}
+		err := c.Compile(arg)
+		if err != nil {
+			return err
+		}
+		positional++
+	}
+	c.emit(code.OpArray, positional+receivers(call))
+	keywords := call.Arguments[positional:]
+	for _, arg := range keywords {
+		kw, ok := arg.(*ast.KeywordArgument)
+		if !ok {
+			return fmt.Errorf("positional argument %s follows keyword argument", arg)
+		}
+		name := &object.String{Value: kw.Name.Value}
+		c.emit(code.OpConstant, c.addConstant(name))
+		err := c.Compile(kw.Value)
+		if err != nil {
+			return err
+		}
+	}
+	if c.tailCalls[call] && !c.isBuiltinCall(call) {
+		c.emit(code.OpTailApply, len(keywords))
+	} else {
+		c.emit(code.OpApply, len(keywords))
+	}
+	return nil
+}
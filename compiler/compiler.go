@@ -2,7 +2,6 @@ package compiler
 
 import (
 	"fmt"
-	"sort"
 	"waiacig/ast"
 	"waiacig/code"
 	"waiacig/object"
@@ -16,6 +15,9 @@ type Compiler struct {
 	symbolTable         *SymbolTable
 	scopes              []CompilationScope
 	scopeIndex          int
+	tailCalls           map[*ast.CallExpression]bool
+	modules             *Modules
+	host                *object.Host
 }
 
 func NewCompiler() *Compiler {
@@ -26,16 +28,14 @@ func NewCompiler() *Compiler {
 	}
 
 	symbolTable := NewSymbolTable()
-
-	for i, v := range object.Builtins {
-		symbolTable.DefineBuiltin(i, v.Name)
-	}
+	symbolTable.DefineBuiltins(nil)
 
 	return &Compiler{
 		constants:   []object.Object{},
 		symbolTable: symbolTable,
 		scopes:      []CompilationScope{mainScope},
 		scopeIndex:  0,
+		tailCalls:   map[*ast.CallExpression]bool{},
 	}
 }
 
@@ -46,9 +46,21 @@ func NewCompilerWithState(s *SymbolTable, constants []object.Object) *Compiler {
 	return compiler
 }
 
+// SetHost lets the program call the functions registered with host, and
+// passes host on to the modules it imports. The VM that runs the bytecode
+// must have the same host.
+func (c *Compiler) SetHost(host *object.Host) {
+	c.host = host
+	c.symbolTable.DefineBuiltins(host)
+}
+
 func (c *Compiler) Compile(node ast.Node) error {
 	switch node := node.(type) {
 	case *ast.Program:
+		err := c.hoistFunctions(node.Statements)
+		if err != nil {
+			return err
+		}
 		for _, s := range node.Statements {
 			err := c.Compile(s)
 			if err != nil {
@@ -56,16 +68,40 @@ func (c *Compiler) Compile(node ast.Node) error {
 			}
 		}
 	case *ast.LetStatement:
-		symbol := c.symbolTable.Define(node.Name.Value)
+		if node.Pattern != nil {
+			err := c.Compile(node.Value)
+			if err != nil {
+				return err
+			}
+			value := c.symbolTable.Define(destructuredValue)
+			c.storeSymbol(value)
+			return c.compileDestructuring(node.Pattern, func() { c.loadSymbol(value) })
+		}
+		if previous, ok := c.symbolTable.store[node.Name.Value]; ok && previous.Const {
+			return fmt.Errorf("cannot redeclare constant %s", node.Name.Value)
+		}
+		if binding, ok := c.symbolTable.forward[node.Name.Value]; ok {
+			return c.compileForwardLet(node, binding)
+		}
+		// A function can refer to the name it's bound to, but any other
+		// value is compiled first, so that it sees a shadowed binding of
+		// the same name.
+		define := c.symbolTable.Define
+		if node.Const {
+			define = c.symbolTable.DefineConst
+		}
+		var symbol Symbol
+		if _, ok := node.Value.(*ast.FunctionLiteral); ok {
+			symbol = define(node.Name.Value)
+		}
 		err := c.Compile(node.Value)
 		if err != nil {
 			return err
 		}
-		if symbol.Scope == GlobalScope {
-			c.emit(code.OpSetGlobal, symbol.Index)
-		} else {
-			c.emit(code.OpSetLocal, symbol.Index)
+		if symbol.Name == "" {
+			symbol = define(node.Name.Value)
 		}
+		c.storeSymbol(symbol)
 	case *ast.Identifier:
 		symbol, ok := c.symbolTable.Resolve(node.Value)
 		if !ok {
@@ -73,9 +109,18 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 
 		c.loadSymbol(symbol)
+		if symbol.Unset {
+			c.emit(code.OpCheckSet)
+		}
 	case *ast.StringLiteral:
 		str := &object.String{Value: node.Value}
 		c.emit(code.OpConstant, c.addConstant(str))
+	case *ast.RegexLiteral:
+		regex := object.NewRegex(node.Pattern)
+		if err, ok := regex.(*object.Error); ok {
+			return fmt.Errorf("%s", err.Message)
+		}
+		c.emit(code.OpConstant, c.addConstant(regex))
 	case *ast.ExpressionStatement:
 		err := c.Compile(node.Expression)
 		if err != nil {
@@ -178,12 +223,18 @@ func (c *Compiler) Compile(node ast.Node) error {
 		c.changeOperand(jumpPos, afterAlternativePos)
 
 	case *ast.BlockStatement:
+		c.enterBlock()
+		err := c.hoistFunctions(node.Statements)
+		if err != nil {
+			return err
+		}
 		for _, s := range node.Statements {
 			err := c.Compile(s)
 			if err != nil {
 				return err
 			}
 		}
+		c.leaveBlock()
 	case *ast.ArrayLiteral:
 		for _, el := range node.Elements {
 			err := c.Compile(el)
@@ -192,15 +243,14 @@ func (c *Compiler) Compile(node ast.Node) error {
 			}
 		}
 		c.emit(code.OpArray, len(node.Elements))
+	case *ast.SpreadElement:
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpSpread)
 	case *ast.HashLiteral:
-		keys := []ast.Expression{}
-		for k := range node.Pairs {
-			keys = append(keys, k)
-		}
-		sort.Slice(keys, func(i, j int) bool {
-			return keys[i].String() < keys[j].String()
-		})
-		for _, k := range keys {
+		for _, k := range node.Keys {
 			err := c.Compile(k)
 			if err != nil {
 				return err
@@ -210,7 +260,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 				return err
 			}
 		}
-		c.emit(code.OpHash, len(node.Pairs)*2)
+		c.emit(code.OpHash, len(node.Keys)*2)
 	case *ast.IndexExpression:
 		err := c.Compile(node.Left)
 		if err != nil {
@@ -222,43 +272,91 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 		c.emit(code.OpIndex)
 	case *ast.FunctionLiteral:
-		c.enterScope()
-		for _, p := range node.Parameters {
-			c.symbolTable.Define(p.Value)
+		_, err := c.compileFunction(node)
+		return err
+	case *ast.FunctionStatement:
+		// Bound by hoistFunctions before the statements around it.
+	case *ast.MatchExpression:
+		return c.compileMatch(node)
+	case *ast.ReturnStatement:
+		err := c.Compile(node.ReturnValue)
+		if err != nil {
+			return err
 		}
-		err := c.Compile(node.Body)
+		err = c.leaveTries()
 		if err != nil {
 			return err
 		}
-		if c.lastInstructionIs(code.OpPop) {
-			c.replaceLastPopWithReturn()
+		c.emit(code.OpReturnValue)
+	case *ast.ThrowStatement:
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
 		}
-		if !c.lastInstructionIs(code.OpReturnValue) {
-			c.emit(code.OpReturn)
+		c.emit(code.OpThrow)
+	case *ast.TryExpression:
+		return c.compileTry(node)
+	case *ast.YieldExpression:
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
 		}
-
-		freeSymbols := c.symbolTable.FreeSymbols
-		numLocals := c.symbolTable.numDefinitions
-		instructions := c.leaveScope()
-
-		for _, s := range freeSymbols {
-			c.loadSymbol(s)
+		if !node.Delegate {
+			c.emit(code.OpYield)
+			return nil
 		}
-
-		compiledFn := &object.CompiledFunction{
-			Instructions:  instructions,
-			NumLocals:     numLocals,
-			NumParameters: len(node.Parameters),
+		loopPos := c.emit(code.OpIterate, 9999)
+		c.emit(code.OpYield)
+		c.emit(code.OpPop)
+		c.emit(code.OpJump, loopPos)
+		c.changeOperand(loopPos, len(c.currentInstructions()))
+		c.emit(code.OpNull)
+	case *ast.AssignExpression:
+		return c.compileAssign(node)
+	case *ast.SliceExpression:
+		err := c.Compile(node.Left)
+		if err != nil {
+			return err
 		}
-		fnIndex := c.addConstant(compiledFn)
-		c.emit(code.OpClosure, fnIndex, len(freeSymbols))
-	case *ast.ReturnStatement:
-		err := c.Compile(node.ReturnValue)
+		for _, bound := range []ast.Expression{node.Start, node.End, node.Step} {
+			if bound == nil {
+				c.emit(code.OpNull)
+				continue
+			}
+			err := c.Compile(bound)
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpSlice)
+	case *ast.RangeExpression:
+		err := c.Compile(node.Start)
 		if err != nil {
 			return err
 		}
-		c.emit(code.OpReturnValue)
+		err = c.Compile(node.End)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpRange)
+	case *ast.ImportExpression:
+		index, err := c.compileModule(node.Path)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpImport, index)
+	case *ast.MethodExpression:
+		err := c.Compile(node.Object)
+		if err != nil {
+			return err
+		}
+		name := &object.String{Value: node.Name.Value}
+		c.emit(code.OpConstant, c.addConstant(name))
+		c.emit(code.OpMethod)
 	case *ast.CallExpression:
+		if needsApply(node) {
+			return c.compileApply(node)
+		}
 		err := c.Compile(node.Function)
 		if err != nil {
 			return err
@@ -269,20 +367,67 @@ func (c *Compiler) Compile(node ast.Node) error {
 				return err
 			}
 		}
-		c.emit(code.OpCall, len(node.Arguments))
+		numArgs := len(node.Arguments) + receivers(node)
+		if c.tailCalls[node] && !c.isBuiltinCall(node) {
+			c.emit(code.OpTailCall, numArgs)
+		} else {
+			c.emit(code.OpCall, numArgs)
+		}
 	}
 	return nil
 }
 
+// markTailCalls records the calls in block whose result is returned as is
+// from the enclosing function: the operand of a return statement, or the last
+// expression of the body, looking through both branches of an if.
+func (c *Compiler) markTailCalls(block *ast.BlockStatement, last bool) {
+	for i, s := range block.Statements {
+		isLast := last && i == len(block.Statements)-1
+		switch s := s.(type) {
+		case *ast.ReturnStatement:
+			c.markTailExpression(s.ReturnValue, true)
+		case *ast.ExpressionStatement:
+			c.markTailExpression(s.Expression, isLast)
+		}
+	}
+}
+
+func (c *Compiler) markTailExpression(exp ast.Expression, tail bool) {
+	switch exp := exp.(type) {
+	case *ast.CallExpression:
+		if tail {
+			c.tailCalls[exp] = true
+		}
+	case *ast.IfExpression:
+		c.markTailCalls(exp.Consequence, tail)
+		if exp.Alternative != nil {
+			c.markTailCalls(exp.Alternative, tail)
+		}
+	}
+}
+
+// isBuiltinCall reports whether a call goes straight to a builtin, which
+// never pushes a frame and so gains nothing from OpTailCall.
+func (c *Compiler) isBuiltinCall(call *ast.CallExpression) bool {
+	ident, ok := call.Function.(*ast.Identifier)
+	if !ok {
+		return false
+	}
+	symbol, ok := c.symbolTable.Resolve(ident.Value)
+	return ok && symbol.Scope == BuiltinScope
+}
+
 type Bytecode struct {
 	Instructions code.Instructions
 	Constants    []object.Object
+	NumLocals    int // slots for the blocks of the main program
 }
 
 func (c *Compiler) Bytecode() *Bytecode {
 	return &Bytecode{
 		Instructions: c.currentInstructions(),
 		Constants:    c.constants,
+		NumLocals:    c.symbolTable.numLocals,
 	}
 }
 
@@ -305,6 +450,15 @@ func (c *Compiler) leaveScope() code.Instructions {
 	return instructions
 }
 
+// enterBlock starts the scope of a block, whose bindings end with it.
+func (c *Compiler) enterBlock() {
+	c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveBlock() {
+	c.symbolTable = c.symbolTable.Outer
+}
+
 func (c *Compiler) loadSymbol(s Symbol) {
 	switch s.Scope {
 	case GlobalScope:
@@ -318,6 +472,56 @@ func (c *Compiler) loadSymbol(s Symbol) {
 	}
 }
 
+// compileAssign compiles an assignment, leaving the value assigned on the
+// stack. Only globals and the function's own locals can be assigned to, as
+// closures hold copies of the variables they capture.
+func (c *Compiler) compileAssign(node *ast.AssignExpression) error {
+	if target, ok := node.Target.(*ast.IndexExpression); ok {
+		err := c.Compile(target.Left)
+		if err != nil {
+			return err
+		}
+		err = c.Compile(target.Index)
+		if err != nil {
+			return err
+		}
+		err = c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpSetIndex)
+		return nil
+	}
+
+	name := node.Target.(*ast.Identifier).Value
+	symbol, ok := c.symbolTable.Resolve(name)
+	switch {
+	case !ok:
+		return fmt.Errorf("cannot assign to undefined variable %s", name)
+	case symbol.Const:
+		return fmt.Errorf("cannot assign to constant %s", name)
+	case symbol.Scope == BuiltinScope:
+		return fmt.Errorf("cannot assign to builtin %s", name)
+	case symbol.Scope == FreeScope:
+		return fmt.Errorf("cannot assign to captured variable %s", name)
+	}
+	err := c.Compile(node.Value)
+	if err != nil {
+		return err
+	}
+	c.storeSymbol(symbol)
+	c.loadSymbol(symbol)
+	return nil
+}
+
+func (c *Compiler) storeSymbol(s Symbol) {
+	if s.Scope == GlobalScope {
+		c.emit(code.OpSetGlobal, s.Index)
+	} else {
+		c.emit(code.OpSetLocal, s.Index)
+	}
+}
+
 func (c *Compiler) addConstant(obj object.Object) int {
 	c.constants = append(c.constants, obj)
 	return len(c.constants) - 1
@@ -392,4 +596,5 @@ type CompilationScope struct {
 	instructions        code.Instructions
 	lastInstruction     EmittedInstruction
 	previousInstruction EmittedInstruction
+	tries               []tryContext
 }
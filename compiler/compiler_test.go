@@ -90,6 +90,12 @@ func testConstants(
 				return fmt.Errorf("constant %d - testStringObject failed: %s",
 					i, err)
 			}
+		case *object.Regex:
+			regex, ok := actual[i].(*object.Regex)
+			if !ok || regex.Inspect() != constant.Inspect() {
+				return fmt.Errorf("constant %d - wrong regex. got=%s, want=%s",
+					i, actual[i].Inspect(), constant.Inspect())
+			}
 		case []code.Instructions:
 			fn, ok := actual[i].(*object.CompiledFunction)
 			if !ok {
@@ -903,6 +909,40 @@ func TestBuiltins(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestHostFunctions(t *testing.T) {
+	host := &object.Host{}
+	err := host.Register(&object.Builtin{
+		Name: "lookup_user",
+		Fn:   func(ctx object.Context, args ...object.Object) object.Object { return nil },
+	})
+	if err != nil {
+		t.Fatalf("register error: %s", err)
+	}
+
+	compiler := NewCompiler()
+	compiler.SetHost(host)
+	if err := compiler.Compile(parse(`lookup_user(); len([])`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	expected := []code.Instructions{
+		code.MakeInstruction(code.OpGetBuiltin, len(object.Builtins)),
+		code.MakeInstruction(code.OpCall, 0),
+		code.MakeInstruction(code.OpPop),
+		code.MakeInstruction(code.OpGetBuiltin, 0),
+		code.MakeInstruction(code.OpArray, 0),
+		code.MakeInstruction(code.OpCall, 1),
+		code.MakeInstruction(code.OpPop),
+	}
+	if err := testInstructions(expected, compiler.Bytecode().Instructions); err != nil {
+		t.Fatalf("testInstructions failed: %s", err)
+	}
+
+	err = NewCompiler().Compile(parse(`lookup_user()`))
+	if err == nil || err.Error() != "undefined variable lookup_user" {
+		t.Errorf("wrong error without the host. got=%v", err)
+	}
+}
+
 func TestClosures(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -1023,3 +1063,433 @@ func TestClosures(t *testing.T) {
 	}
 	runCompilerTests(t, tests)
 }
+
+func TestTailCalls(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `fn(a) { a(a) }`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.MakeInstruction(code.OpGetLocal, 0),
+					code.MakeInstruction(code.OpGetLocal, 0),
+					code.MakeInstruction(code.OpTailCall, 1),
+					code.MakeInstruction(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpClosure, 0, 0),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input: `fn(a) { a(); 1 }`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.MakeInstruction(code.OpGetLocal, 0),
+					code.MakeInstruction(code.OpCall, 0),
+					code.MakeInstruction(code.OpPop),
+					code.MakeInstruction(code.OpConstant, 0),
+					code.MakeInstruction(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpClosure, 1, 0),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input: `fn(a) { if (a) { return a(); } a() + 1 }`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.MakeInstruction(code.OpGetLocal, 0),
+					code.MakeInstruction(code.OpJumpNotTruthy, 13),
+					code.MakeInstruction(code.OpGetLocal, 0),
+					code.MakeInstruction(code.OpTailCall, 0),
+					code.MakeInstruction(code.OpReturnValue),
+					code.MakeInstruction(code.OpJump, 14),
+					code.MakeInstruction(code.OpNull),
+					code.MakeInstruction(code.OpPop),
+					code.MakeInstruction(code.OpGetLocal, 0),
+					code.MakeInstruction(code.OpCall, 0),
+					code.MakeInstruction(code.OpConstant, 0),
+					code.MakeInstruction(code.OpAdd),
+					code.MakeInstruction(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpClosure, 1, 0),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestDefaultParametersAndApply(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `fn(a, b = 2) { a + b }`,
+			expectedConstants: []interface{}{
+				2,
+				[]code.Instructions{
+					code.MakeInstruction(code.OpJumpIfBound, 1, 9),
+					code.MakeInstruction(code.OpConstant, 0),
+					code.MakeInstruction(code.OpSetLocal, 1),
+					code.MakeInstruction(code.OpGetLocal, 0),
+					code.MakeInstruction(code.OpGetLocal, 1),
+					code.MakeInstruction(code.OpAdd),
+					code.MakeInstruction(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpClosure, 1, 0),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input: `fn(f, xs) { f(...xs, k: 1) }`,
+			expectedConstants: []interface{}{
+				"k",
+				1,
+				[]code.Instructions{
+					code.MakeInstruction(code.OpGetLocal, 0),
+					code.MakeInstruction(code.OpGetLocal, 1),
+					code.MakeInstruction(code.OpSpread),
+					code.MakeInstruction(code.OpArray, 1),
+					code.MakeInstruction(code.OpConstant, 0),
+					code.MakeInstruction(code.OpConstant, 1),
+					code.MakeInstruction(code.OpTailApply, 1),
+					code.MakeInstruction(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpClosure, 2, 0),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestTryExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `try { 1 } catch (e) { e }`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.MakeInstruction(code.OpTry, 10),
+				// 0003
+				code.MakeInstruction(code.OpConstant, 0),
+				// 0006
+				code.MakeInstruction(code.OpEndTry),
+				// 0007
+				code.MakeInstruction(code.OpJump, 14),
+				// 0010
+				code.MakeInstruction(code.OpSetLocal, 0),
+				// 0012
+				code.MakeInstruction(code.OpGetLocal, 0),
+				// 0014
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input: `fn() { try { return 1 } finally { 2 } }`,
+			expectedConstants: []interface{}{
+				1,
+				2,
+				2,
+				2,
+				[]code.Instructions{
+					code.MakeInstruction(code.OpTry, 24),
+					code.MakeInstruction(code.OpConstant, 0),
+					code.MakeInstruction(code.OpEndTry),
+					code.MakeInstruction(code.OpConstant, 1),
+					code.MakeInstruction(code.OpPop),
+					code.MakeInstruction(code.OpReturnValue),
+					code.MakeInstruction(code.OpNull),
+					code.MakeInstruction(code.OpEndTry),
+					code.MakeInstruction(code.OpJump, 17),
+					code.MakeInstruction(code.OpConstant, 2),
+					code.MakeInstruction(code.OpPop),
+					code.MakeInstruction(code.OpJump, 29),
+					code.MakeInstruction(code.OpConstant, 3),
+					code.MakeInstruction(code.OpPop),
+					code.MakeInstruction(code.OpThrow),
+					code.MakeInstruction(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpClosure, 4, 0),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestDotAccessAndMethodCalls(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `let h = {}; h.f; h.g(1)`,
+			expectedConstants: []interface{}{"f", "g", 1},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpHash, 0),
+				code.MakeInstruction(code.OpSetGlobal, 0),
+				code.MakeInstruction(code.OpGetGlobal, 0),
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpIndex),
+				code.MakeInstruction(code.OpPop),
+				code.MakeInstruction(code.OpGetGlobal, 0),
+				code.MakeInstruction(code.OpConstant, 1),
+				code.MakeInstruction(code.OpMethod),
+				code.MakeInstruction(code.OpConstant, 2),
+				code.MakeInstruction(code.OpCall, 2),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input:             `let h = {}; h.g(...[1])`,
+			expectedConstants: []interface{}{"g", 1},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpHash, 0),
+				code.MakeInstruction(code.OpSetGlobal, 0),
+				code.MakeInstruction(code.OpGetGlobal, 0),
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpMethod),
+				code.MakeInstruction(code.OpConstant, 1),
+				code.MakeInstruction(code.OpArray, 1),
+				code.MakeInstruction(code.OpSpread),
+				code.MakeInstruction(code.OpArray, 2),
+				code.MakeInstruction(code.OpApply, 0),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestSlicesAndRanges(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `[][1:]`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpArray, 0),
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpNull),
+				code.MakeInstruction(code.OpNull),
+				code.MakeInstruction(code.OpSlice),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input:             `1..2`,
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpConstant, 1),
+				code.MakeInstruction(code.OpRange),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestAssignments(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `let x = 1; x = 2`,
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpSetGlobal, 0),
+				code.MakeInstruction(code.OpConstant, 1),
+				code.MakeInstruction(code.OpSetGlobal, 0),
+				code.MakeInstruction(code.OpGetGlobal, 0),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input:             `let xs = []; xs[0] = 1`,
+			expectedConstants: []interface{}{0, 1},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpArray, 0),
+				code.MakeInstruction(code.OpSetGlobal, 0),
+				code.MakeInstruction(code.OpGetGlobal, 0),
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpConstant, 1),
+				code.MakeInstruction(code.OpSetIndex),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestBlockScopes(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `let x = 1; if (true) { let x = 2; x }; if (true) { let y = x; y }`,
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.MakeInstruction(code.OpConstant, 0),
+				// 0003
+				code.MakeInstruction(code.OpSetGlobal, 0),
+				// 0006
+				code.MakeInstruction(code.OpTrue),
+				// 0007
+				code.MakeInstruction(code.OpJumpNotTruthy, 20),
+				// 0010
+				code.MakeInstruction(code.OpConstant, 1),
+				// 0013
+				code.MakeInstruction(code.OpSetLocal, 0),
+				// 0015
+				code.MakeInstruction(code.OpGetLocal, 0),
+				// 0017
+				code.MakeInstruction(code.OpJump, 21),
+				// 0020
+				code.MakeInstruction(code.OpNull),
+				// 0021
+				code.MakeInstruction(code.OpPop),
+				// 0022
+				code.MakeInstruction(code.OpTrue),
+				// 0023
+				code.MakeInstruction(code.OpJumpNotTruthy, 36),
+				// 0026
+				code.MakeInstruction(code.OpGetGlobal, 0),
+				// 0029
+				code.MakeInstruction(code.OpSetLocal, 0),
+				// 0031
+				code.MakeInstruction(code.OpGetLocal, 0),
+				// 0033
+				code.MakeInstruction(code.OpJump, 37),
+				// 0036
+				code.MakeInstruction(code.OpNull),
+				// 0037
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+
+	compiler := NewCompiler()
+	err := compiler.Compile(parse(`if (true) { let a = 1; if (true) { let b = 2 } }; if (true) { let c = 3 }`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	if compiler.Bytecode().NumLocals != 2 {
+		t.Errorf("wrong NumLocals. want=2, got=%d", compiler.Bytecode().NumLocals)
+	}
+	if compiler.symbolTable.numDefinitions != 0 {
+		t.Errorf("block bindings defined as globals: %d", compiler.symbolTable.numDefinitions)
+	}
+}
+
+func TestFunctionDeclarations(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `f(); fn f() { 1 }`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.MakeInstruction(code.OpConstant, 0),
+					code.MakeInstruction(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpClosure, 1, 0),
+				code.MakeInstruction(code.OpSetGlobal, 0),
+				code.MakeInstruction(code.OpGetGlobal, 0),
+				code.MakeInstruction(code.OpCall, 0),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+		{
+			input: `fn() { fn a() { b() } fn b() { a() } }`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.MakeInstruction(code.OpGetFree, 0),
+					code.MakeInstruction(code.OpTailCall, 0),
+					code.MakeInstruction(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.MakeInstruction(code.OpGetFree, 0),
+					code.MakeInstruction(code.OpTailCall, 0),
+					code.MakeInstruction(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.MakeInstruction(code.OpGetLocal, 1),
+					code.MakeInstruction(code.OpClosure, 0, 1),
+					code.MakeInstruction(code.OpSetLocal, 0),
+					code.MakeInstruction(code.OpGetLocal, 0),
+					code.MakeInstruction(code.OpClosure, 1, 1),
+					code.MakeInstruction(code.OpSetLocal, 1),
+					code.MakeInstruction(code.OpGetLocal, 0),
+					code.MakeInstruction(code.OpGetLocal, 1),
+					code.MakeInstruction(code.OpPatchFree, 0),
+					code.MakeInstruction(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpClosure, 2, 0),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestRegexLiterals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `/a+b/.match("aab")`,
+			expectedConstants: []interface{}{
+				object.NewRegex("a+b"),
+				"match",
+				"aab",
+			},
+			expectedInstructions: []code.Instructions{
+				code.MakeInstruction(code.OpConstant, 0),
+				code.MakeInstruction(code.OpConstant, 1),
+				code.MakeInstruction(code.OpMethod),
+				code.MakeInstruction(code.OpConstant, 2),
+				code.MakeInstruction(code.OpCall, 2),
+				code.MakeInstruction(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestAssignmentErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`const a = 1; a = 2`, "cannot assign to constant a"},
+		{`const a = 1; fn() { a = 2 }`, "cannot assign to constant a"},
+		{`const a = 1; let a = 2`, "cannot redeclare constant a"},
+		{`const a = 1; fn a() { 2 }`, "cannot redeclare constant a"},
+		{`fn a() { 2 } const a = 1`, "cannot redeclare constant a"},
+		{`fn() { const a = 1; fn a() { 2 } }`, "cannot redeclare constant a"},
+		{`b = 1`, "cannot assign to undefined variable b"},
+		{`len = 1`, "cannot assign to builtin len"},
+		{`fn() { let n = 0; fn() { n = 1 } }`, "cannot assign to captured variable n"},
+	}
+	for _, tt := range tests {
+		compiler := NewCompiler()
+		err := compiler.Compile(parse(tt.input))
+		if err == nil {
+			t.Errorf("expected compiler error for %q", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong compiler error. want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package compiler
+
+import (
+	"fmt"
+	"waiacig/ast"
+	"waiacig/code"
+	"waiacig/object"
+)
+
+// compileFunction compiles a function literal into a closure, returning the
+// symbols of the free variables the closure captures.
+func (c *Compiler) compileFunction(node *ast.FunctionLiteral) ([]Symbol, error) {
+	c.enterScope()
+	for _, p := range node.Parameters {
+		c.symbolTable.Define(p.Value)
+	}
+	if node.Rest != nil {
+		c.symbolTable.Define(node.Rest.Value)
+	}
+	err := c.compileDefaults(node)
+	if err != nil {
+		return nil, err
+	}
+	for i, pattern := range node.Patterns {
+		if pattern == nil {
+			continue
+		}
+		index := i
+		err := c.compileDestructuring(pattern, func() { c.emit(code.OpGetLocal, index) })
+		if err != nil {
+			return nil, err
+		}
+	}
+	if node.IsGenerator {
+		c.emit(code.OpSuspend)
+	}
+	c.markTailCalls(node.Body, true)
+	err = c.Compile(node.Body)
+	if err != nil {
+		return nil, err
+	}
+	if c.lastInstructionIs(code.OpPop) {
+		c.replaceLastPopWithReturn()
+	}
+	if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpReturn)
+	}
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	numLocals := c.symbolTable.numLocals
+	instructions := c.leaveScope()
+
+	for _, s := range freeSymbols {
+		c.loadSymbol(s)
+	}
+
+	compiledFn := &object.CompiledFunction{
+		Instructions:   instructions,
+		NumLocals:      numLocals,
+		NumParameters:  len(node.Parameters),
+		NumDefaults:    countDefaults(node),
+		Variadic:       node.Rest != nil,
+		ParameterNames: parameterNames(node),
+		Generator:      node.IsGenerator,
+		Name:           node.Name,
+	}
+	fnIndex := c.addConstant(compiledFn)
+	c.emit(code.OpClosure, fnIndex, len(freeSymbols))
+	return freeSymbols, nil
+}
+
+// hoistFunctions binds the functions declared among statements before any of
+// the statements are compiled, so that they can call each other whatever
+// their order. Their bodies also see the names the statements bind with
+// let, as they do in the evaluator, where names are looked up when the
+// function runs; see forwardLets.
+//
+// A local function holds copies of the variables it captures, taken when
+// its closure is made; one that captures a function declared alongside it,
+// itself or a later one, has that copy patched with OpPatchFree once all of
+// them exist, and one that captures a let binding has it patched by the let.
+func (c *Compiler) hoistFunctions(statements []ast.Statement) error {
+	c.symbolTable.forward = nil
+	consts := constNames(statements)
+	declarations := []*ast.FunctionStatement{}
+	symbols := []Symbol{}
+	for _, s := range statements {
+		declaration, ok := s.(*ast.FunctionStatement)
+		if !ok {
+			continue
+		}
+		name := declaration.Name.Value
+		if previous, ok := c.symbolTable.store[name]; (ok && previous.Const) || consts[name] {
+			return fmt.Errorf("cannot redeclare constant %s", name)
+		}
+		declarations = append(declarations, declaration)
+		symbols = append(symbols, c.symbolTable.Define(name))
+	}
+	if len(declarations) == 0 {
+		return nil
+	}
+
+	pending := c.forwardLets(statements)
+	captured := make([][]Symbol, len(declarations))
+	for i, declaration := range declarations {
+		free, err := c.compileFunction(declaration.Function)
+		if err != nil {
+			return err
+		}
+		captured[i] = free
+		c.storeSymbol(symbols[i])
+	}
+	// Until their lets, the names refer to whatever they did before.
+	for _, name := range pending {
+		delete(c.symbolTable.store, name)
+	}
+	for i, free := range captured {
+		for freeIndex, symbol := range free {
+			if binding, ok := c.symbolTable.forward[symbol.Name]; ok && binding.symbol == symbol {
+				binding.captures = append(binding.captures, capture{fn: symbols[i], index: freeIndex})
+			}
+		}
+	}
+	for i, free := range captured {
+		for freeIndex, symbol := range free {
+			for j := i; j < len(symbols); j++ {
+				declared := symbols[j]
+				if symbol != declared {
+					continue
+				}
+				c.loadSymbol(symbols[i])
+				c.loadSymbol(declared)
+				c.emit(code.OpPatchFree, freeIndex)
+			}
+		}
+	}
+	return nil
+}
+
+// constNames returns the names bound by const among statements. A function
+// declared there can't have one of them, whether the const comes before or
+// after it.
+func constNames(statements []ast.Statement) map[string]bool {
+	names := map[string]bool{}
+	for _, s := range statements {
+		if let, ok := s.(*ast.LetStatement); ok && let.Const && let.Name != nil {
+			names[let.Name.Value] = true
+		}
+	}
+	return names
+}
+
+// forwardBinding is a name bound by let among statements that declare
+// functions. The functions are compiled first, referring to the binding's
+// symbol, and the let stores its value there.
+type forwardBinding struct {
+	symbol   Symbol
+	captures []capture // the copies of the binding local functions hold
+}
+
+type capture struct {
+	fn    Symbol // a function declared among the statements
+	index int    // the free variable of the function holding the copy
+}
+
+// forwardLets sets up the forward bindings of the names bound by lets among
+// statements, putting them in scope for the bodies of the functions declared
+// there. A name the table already has keeps its symbol, which the lets store
+// into; any other gets a new one, holding a value that makes reading it an
+// error until the let runs. It returns the new names, which are taken out
+// of scope again until their lets.
+func (c *Compiler) forwardLets(statements []ast.Statement) []string {
+	c.symbolTable.forward = map[string]*forwardBinding{}
+	pending := []string{}
+	for _, s := range statements {
+		let, ok := s.(*ast.LetStatement)
+		if !ok || let.Pattern != nil {
+			continue
+		}
+		name := let.Name.Value
+		if _, ok := c.symbolTable.forward[name]; ok {
+			continue
+		}
+		symbol, ok := c.symbolTable.store[name]
+		if ok && (symbol.Const || symbol.Scope == BuiltinScope) {
+			continue
+		}
+		if !ok {
+			symbol = c.symbolTable.Define(name)
+			symbol.Unset = true
+			c.symbolTable.store[name] = symbol
+			c.emit(code.OpUnset, c.addConstant(&object.String{Value: name}))
+			c.storeSymbol(symbol)
+			pending = append(pending, name)
+		}
+		c.symbolTable.forward[name] = &forwardBinding{symbol: symbol}
+	}
+	return pending
+}
+
+// compileForwardLet compiles a let of a forward binding: it stores the value
+// in the binding's symbol and patches the functions that captured it.
+func (c *Compiler) compileForwardLet(node *ast.LetStatement, binding *forwardBinding) error {
+	symbol := binding.symbol
+	symbol.Const = node.Const
+	symbol.Unset = false
+	if _, ok := node.Value.(*ast.FunctionLiteral); ok {
+		c.symbolTable.store[symbol.Name] = symbol
+	}
+	err := c.Compile(node.Value)
+	if err != nil {
+		return err
+	}
+	c.symbolTable.store[symbol.Name] = symbol
+	c.storeSymbol(symbol)
+	for _, captured := range binding.captures {
+		c.loadSymbol(captured.fn)
+		c.loadSymbol(symbol)
+		c.emit(code.OpPatchFree, captured.index)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package compiler
+
+import (
+	"waiacig/ast"
+	"waiacig/code"
+	"waiacig/object"
+)
+
+// Hidden bindings for the value being matched or destructured. Their names
+// can't be written in source, so they never clash with a user binding.
+const (
+	matchSubject      = "%match"
+	destructuredValue = "%destructure"
+)
+
+// compileMatch compiles a match expression into a sequence of tests, one arm
+// after the other. Every failing test jumps to the next arm; an arm whose
+// pattern and guard both pass leaves its body's value on the stack and jumps
+// past the remaining arms. Falling through all arms raises OpNoMatch.
+func (c *Compiler) compileMatch(node *ast.MatchExpression) error {
+	err := c.Compile(node.Subject)
+	if err != nil {
+		return err
+	}
+	c.enterBlock()
+	subject := c.symbolTable.Define(matchSubject)
+	c.storeSymbol(subject)
+	load := func() { c.loadSymbol(subject) }
+
+	endJumps := []int{}
+	for _, arm := range node.Arms {
+		c.enterBlock()
+		failJumps := []int{}
+		err := c.compilePattern(arm.Pattern, load, &failJumps)
+		if err != nil {
+			return err
+		}
+		if arm.Guard != nil {
+			err := c.Compile(arm.Guard)
+			if err != nil {
+				return err
+			}
+			failJumps = append(failJumps, c.emit(code.OpJumpNotTruthy, 9999))
+		}
+		err = c.Compile(arm.Body)
+		if err != nil {
+			return err
+		}
+		endJumps = append(endJumps, c.emit(code.OpJump, 9999))
+		c.leaveBlock()
+
+		nextArmPos := len(c.currentInstructions())
+		for _, pos := range failJumps {
+			c.changeOperand(pos, nextArmPos)
+		}
+	}
+	load()
+	c.emit(code.OpNoMatch)
+
+	afterMatchPos := len(c.currentInstructions())
+	for _, pos := range endJumps {
+		c.changeOperand(pos, afterMatchPos)
+	}
+	c.leaveBlock()
+	return nil
+}
+
+// compileDestructuring binds the names in pattern from the value pushed by
+// load. Unlike a match arm, a value that doesn't fit the pattern raises a
+// runtime error.
+func (c *Compiler) compileDestructuring(pattern ast.Pattern, load func()) error {
+	failJumps := []int{}
+	err := c.compilePattern(pattern, load, &failJumps)
+	if err != nil {
+		return err
+	}
+	if len(failJumps) == 0 {
+		return nil
+	}
+	jumpPos := c.emit(code.OpJump, 9999)
+	failPos := len(c.currentInstructions())
+	for _, pos := range failJumps {
+		c.changeOperand(pos, failPos)
+	}
+	load()
+	c.emit(code.OpDestructureError, c.addConstant(&object.String{Value: pattern.String()}))
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+// compilePattern emits the tests and bindings for pattern. load emits the
+// code that pushes the value under test; every emitted test that can fail
+// records its jump in failJumps, to be patched by the caller.
+func (c *Compiler) compilePattern(
+	pattern ast.Pattern,
+	load func(),
+	failJumps *[]int,
+) error {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value == "_" {
+			return nil
+		}
+		load()
+		c.storeSymbol(c.symbolTable.Define(pattern.Value))
+	case *ast.IntegerLiteral, *ast.StringLiteral, *ast.Boolean:
+		load()
+		err := c.Compile(pattern)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpMatchValue)
+		*failJumps = append(*failJumps, c.emit(code.OpJumpNotTruthy, 9999))
+	case *ast.ArrayPattern:
+		hasRest := 0
+		if pattern.Rest != nil {
+			hasRest = 1
+		}
+		load()
+		c.emit(code.OpMatchArray, len(pattern.Elements), hasRest)
+		*failJumps = append(*failJumps, c.emit(code.OpJumpNotTruthy, 9999))
+		for i, el := range pattern.Elements {
+			index := c.addConstant(&object.Integer{Value: int64(i)})
+			loadElement := func() {
+				load()
+				c.emit(code.OpConstant, index)
+				c.emit(code.OpIndex)
+			}
+			err := c.compilePattern(el, loadElement, failJumps)
+			if err != nil {
+				return err
+			}
+		}
+		if pattern.Rest != nil && pattern.Rest.Value != "_" {
+			load()
+			c.emit(code.OpArrayRest, len(pattern.Elements))
+			c.storeSymbol(c.symbolTable.Define(pattern.Rest.Value))
+		}
+	case *ast.HashPattern:
+		load()
+		c.emit(code.OpMatchHash)
+		*failJumps = append(*failJumps, c.emit(code.OpJumpNotTruthy, 9999))
+		for i, key := range pattern.Keys {
+			key := key
+			load()
+			err := c.Compile(key)
+			if err != nil {
+				return err
+			}
+			c.emit(code.OpMatchKey)
+			*failJumps = append(*failJumps, c.emit(code.OpJumpNotTruthy, 9999))
+			var keyErr error
+			loadValue := func() {
+				load()
+				if err := c.Compile(key); err != nil && keyErr == nil {
+					keyErr = err
+				}
+				c.emit(code.OpIndex)
+			}
+			err = c.compilePattern(pattern.Values[i], loadValue, failJumps)
+			if err != nil {
+				return err
+			}
+			if keyErr != nil {
+				return keyErr
+			}
+		}
+	}
+	return nil
+}
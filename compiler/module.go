@@ -0,0 +1,100 @@
+package compiler
+
+import (
+	"fmt"
+	"waiacig/module"
+	"waiacig/object"
+)
+
+// Modules is shared by a compiler and the compilers of the modules it
+// imports, so that each module is compiled once however often it's
+// imported.
+type Modules struct {
+	loader   *module.Loader
+	compiled map[string]int // constant index of each module, by file
+}
+
+// NewModules returns the Modules of compilers importing modules found by
+// loader.
+func NewModules(loader *module.Loader) *Modules {
+	return &Modules{loader: loader, compiled: map[string]int{}}
+}
+
+// importError is an error in an imported module. It's reported as is by
+// the modules importing that one.
+type importError struct {
+	path string // the module's import path, if the error is in its code
+	err  error
+}
+
+func (e *importError) Error() string {
+	if e.path == "" {
+		return e.err.Error()
+	}
+	return e.path + ": " + e.err.Error()
+}
+
+// SetModuleLoader lets the program import modules found by loader.
+func (c *Compiler) SetModuleLoader(loader *module.Loader) {
+	c.modules = NewModules(loader)
+}
+
+// SetModules lets the program import modules like SetModuleLoader, reusing
+// those compiled by the other compilers given modules. The compilers must
+// share their constants, as those of a REPL's lines do.
+func (c *Compiler) SetModules(modules *Modules) {
+	c.modules = modules
+}
+
+// compileModule compiles the module imported as path into a CompiledModule
+// constant, returning its index. The module gets a symbol table of its own,
+// so its globals are separate from the importer's, but it shares the
+// importer's constants.
+func (c *Compiler) compileModule(path string) (int, error) {
+	if c.modules == nil {
+		return 0, fmt.Errorf("cannot import %s: no module loader", path)
+	}
+	loader := c.modules.loader
+	file, err := loader.Resolve(path)
+	if err != nil {
+		return 0, &importError{err: err}
+	}
+	if index, ok := c.modules.compiled[file]; ok {
+		return index, nil
+	}
+	program, err := loader.Enter(path, file)
+	if err != nil {
+		return 0, &importError{err: err}
+	}
+	defer loader.Leave()
+
+	symbolTable := NewSymbolTable()
+	symbolTable.DefineBuiltins(c.host)
+	compiler := NewCompilerWithState(symbolTable, c.constants)
+	compiler.modules = c.modules
+	compiler.host = c.host
+	err = compiler.Compile(program)
+	if _, ok := err.(*importError); ok {
+		return 0, err
+	}
+	if err != nil {
+		return 0, &importError{path: path, err: err}
+	}
+	c.constants = compiler.constants
+
+	exports := map[string]int{}
+	for name, symbol := range symbolTable.store {
+		if symbol.Scope == GlobalScope && module.Exported(name) {
+			exports[name] = symbol.Index
+		}
+	}
+	index := c.addConstant(&object.CompiledModule{
+		Name:         path,
+		Instructions: compiler.currentInstructions(),
+		NumGlobals:   symbolTable.numDefinitions,
+		NumLocals:    symbolTable.numLocals,
+		Exports:      exports,
+	})
+	c.modules.compiled[file] = index
+	return index, nil
+}
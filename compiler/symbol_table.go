@@ -1,5 +1,7 @@
 package compiler
 
+import "waiacig/object"
+
 type SymbolScope string
 
 const (
@@ -13,6 +15,10 @@ type Symbol struct {
 	Name  string
 	Scope SymbolScope
 	Index int
+	Const bool // bound by const, so it can't be assigned to
+	// Unset is set for a let binding that functions declared before the
+	// let can read before it runs; see forwardLets.
+	Unset bool
 }
 
 type SymbolTable struct {
@@ -20,6 +26,17 @@ type SymbolTable struct {
 	store          map[string]Symbol
 	numDefinitions int
 	FreeSymbols    []Symbol
+
+	// block is set for the table of a block inside a function or the main
+	// program. Its names are locals of the enclosing frame, in slots that
+	// are free again once the block ends.
+	block bool
+	// forward holds the let bindings that functions declared in this
+	// scope were compiled against, by name.
+	forward map[string]*forwardBinding
+	// numLocals is the most local slots in use at once in the frame of a
+	// function or the main program, counting those of its blocks.
+	numLocals int
 }
 
 func NewSymbolTable() *SymbolTable {
@@ -30,7 +47,12 @@ func NewSymbolTable() *SymbolTable {
 
 func (s *SymbolTable) defineFree(original Symbol) Symbol {
 	s.FreeSymbols = append(s.FreeSymbols, original)
-	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1}
+	symbol := Symbol{
+		Name:  original.Name,
+		Index: len(s.FreeSymbols) - 1,
+		Const: original.Const,
+		Unset: original.Unset,
+	}
 	symbol.Scope = FreeScope
 	s.store[original.Name] = symbol
 	return symbol
@@ -42,6 +64,18 @@ func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
 	return s
 }
 
+// NewBlockSymbolTable returns the table for a block in outer's scope. The
+// block's names shadow outer's, and take the local slots after those in use
+// by outer.
+func NewBlockSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewEnclosedSymbolTable(outer)
+	s.block = true
+	if outer.block || outer.Outer != nil {
+		s.numDefinitions = outer.numDefinitions
+	}
+	return s
+}
+
 func (s *SymbolTable) Define(name string) Symbol {
 	symbol := Symbol{Name: name, Index: s.numDefinitions}
 	if s.Outer == nil {
@@ -51,6 +85,24 @@ func (s *SymbolTable) Define(name string) Symbol {
 	}
 	s.store[name] = symbol
 	s.numDefinitions++
+	if symbol.Scope == LocalScope {
+		frame := s
+		for frame.block {
+			frame = frame.Outer
+		}
+		if frame.numLocals < s.numDefinitions {
+			frame.numLocals = s.numDefinitions
+		}
+	}
+	return symbol
+}
+
+// DefineConst defines name like Define, as a binding that can't be
+// assigned to.
+func (s *SymbolTable) DefineConst(name string) Symbol {
+	symbol := s.Define(name)
+	symbol.Const = true
+	s.store[name] = symbol
 	return symbol
 }
 
@@ -61,7 +113,7 @@ func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
 		if !ok {
 			return obj, ok
 		}
-		if obj.Scope == GlobalScope || obj.Scope == BuiltinScope {
+		if s.block || obj.Scope == GlobalScope || obj.Scope == BuiltinScope {
 			return obj, ok
 		}
 		free := s.defineFree(obj)
@@ -70,6 +122,17 @@ func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
 	return obj, ok
 }
 
+// DefineBuiltins defines the builtins, followed by the functions registered
+// with host if it isn't nil, at the indexes OpGetBuiltin finds them by.
+// Names s already has keep their meaning.
+func (s *SymbolTable) DefineBuiltins(host *object.Host) {
+	for i, b := range host.Builtins() {
+		if _, ok := s.store[b.Name]; !ok {
+			s.DefineBuiltin(i, b.Name)
+		}
+	}
+}
+
 func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
 	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
 	s.store[name] = symbol
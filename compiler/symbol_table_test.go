@@ -269,3 +269,81 @@ func TestResolveUnresolvableFree(t *testing.T) {
 		}
 	}
 }
+
+func TestDefineConst(t *testing.T) {
+	global := NewSymbolTable()
+	global.DefineConst("a")
+	local := NewEnclosedSymbolTable(NewEnclosedSymbolTable(global))
+	local.Outer.DefineConst("b")
+
+	expected := []Symbol{
+		{Name: "a", Scope: GlobalScope, Index: 0, Const: true},
+		{Name: "b", Scope: FreeScope, Index: 0, Const: true},
+	}
+	for _, sym := range expected {
+		result, ok := local.Resolve(sym.Name)
+		if !ok {
+			t.Errorf("name %s not resolvable", sym.Name)
+			continue
+		}
+		if result != sym {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+		}
+	}
+}
+
+func TestBlockSymbolTable(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	first := NewBlockSymbolTable(global)
+	first.Define("a")
+	first.Define("b")
+	second := NewBlockSymbolTable(global)
+	second.Define("c")
+
+	local := NewEnclosedSymbolTable(global)
+	local.Define("d")
+	inner := NewBlockSymbolTable(local)
+	inner.Define("e")
+	innermost := NewBlockSymbolTable(inner)
+	innermost.Define("f")
+
+	tests := []struct {
+		table    *SymbolTable
+		expected Symbol
+	}{
+		{global, Symbol{Name: "a", Scope: GlobalScope, Index: 0}},
+		{first, Symbol{Name: "a", Scope: LocalScope, Index: 0}},
+		{first, Symbol{Name: "b", Scope: LocalScope, Index: 1}},
+		{second, Symbol{Name: "a", Scope: GlobalScope, Index: 0}},
+		{second, Symbol{Name: "c", Scope: LocalScope, Index: 0}},
+		{innermost, Symbol{Name: "d", Scope: LocalScope, Index: 0}},
+		{innermost, Symbol{Name: "e", Scope: LocalScope, Index: 1}},
+		{innermost, Symbol{Name: "f", Scope: LocalScope, Index: 2}},
+	}
+	for _, tt := range tests {
+		result, ok := tt.table.Resolve(tt.expected.Name)
+		if !ok {
+			t.Errorf("name %s not resolvable", tt.expected.Name)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("expected %s to resolve to %+v, got=%+v",
+				tt.expected.Name, tt.expected, result)
+		}
+	}
+	if _, ok := second.Resolve("b"); ok {
+		t.Errorf("name b resolvable outside its block")
+	}
+
+	if global.numDefinitions != 1 {
+		t.Errorf("wrong number of globals. want=1, got=%d", global.numDefinitions)
+	}
+	if global.numLocals != 2 {
+		t.Errorf("wrong number of main program locals. want=2, got=%d", global.numLocals)
+	}
+	if local.numLocals != 3 {
+		t.Errorf("wrong number of function locals. want=3, got=%d", local.numLocals)
+	}
+}
@@ -0,0 +1,148 @@
+package compiler
+
+import (
+	"waiacig/ast"
+	"waiacig/code"
+)
+
+// tryContext describes a try expression enclosing the code being compiled,
+// so that a return from inside it can take down its handler and run its
+// finally block on the way out.
+type tryContext struct {
+	handler bool // a handler is set up around the code being compiled
+	finally *ast.BlockStatement
+}
+
+// compileTry compiles a try expression. OpTry and OpEndTry bracket the
+// instructions an error handler covers: if one of them raises an error, the
+// VM unwinds to the frame and stack height at OpTry and jumps to its
+// handler with the caught value pushed. Laid out, with [] marking the parts
+// only present with a catch or finally block:
+//
+//	      OpTry handler
+//	      <try block>
+//	      OpEndTry
+//	      OpJump normal
+//	     [catch:
+//	      <bind or pop the caught value>
+//	      OpTry finallyError if there's a finally block
+//	      <catch block>
+//	      OpEndTry if there's a finally block]
+//	normal:
+//	     [<finally block>
+//	      OpJump end
+//	finallyError:
+//	      <finally block>
+//	      OpThrow]
+//	end:
+func (c *Compiler) compileTry(node *ast.TryExpression) error {
+	hasFinally := node.Finally != nil
+	c.pushTry(tryContext{handler: true, finally: node.Finally})
+	tryPos := c.emit(code.OpTry, 9999)
+	err := c.compileBlockValue(node.Block)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpEndTry)
+	normalJump := c.emit(code.OpJump, 9999)
+
+	finallyTries := []int{}
+	if node.Catch != nil {
+		c.changeOperand(tryPos, len(c.currentInstructions()))
+		c.enterBlock()
+		if node.Param != nil {
+			c.storeSymbol(c.symbolTable.Define(node.Param.Value))
+		} else {
+			c.emit(code.OpPop)
+		}
+		c.setTryHandler(hasFinally)
+		if hasFinally {
+			finallyTries = append(finallyTries, c.emit(code.OpTry, 9999))
+		}
+		err := c.compileBlockValue(node.Catch)
+		if err != nil {
+			return err
+		}
+		c.leaveBlock()
+		if hasFinally {
+			c.emit(code.OpEndTry)
+		}
+	} else {
+		finallyTries = append(finallyTries, tryPos)
+	}
+	c.popTry()
+	c.changeOperand(normalJump, len(c.currentInstructions()))
+
+	if !hasFinally {
+		return nil
+	}
+	err = c.Compile(node.Finally)
+	if err != nil {
+		return err
+	}
+	endJump := c.emit(code.OpJump, 9999)
+	for _, pos := range finallyTries {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	err = c.Compile(node.Finally)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpThrow)
+	c.changeOperand(endJump, len(c.currentInstructions()))
+	return nil
+}
+
+// leaveTries emits what a return has to do before leaving the try
+// expressions around it: take down their handlers and run their finally
+// blocks, innermost first.
+func (c *Compiler) leaveTries() error {
+	tries := c.scopes[c.scopeIndex].tries
+	for i := len(tries) - 1; i >= 0; i-- {
+		if tries[i].handler {
+			c.emit(code.OpEndTry)
+		}
+		if tries[i].finally == nil {
+			continue
+		}
+		c.scopes[c.scopeIndex].tries = tries[:i]
+		err := c.Compile(tries[i].finally)
+		c.scopes[c.scopeIndex].tries = tries
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) pushTry(try tryContext) {
+	scope := &c.scopes[c.scopeIndex]
+	scope.tries = append(scope.tries, try)
+}
+
+func (c *Compiler) popTry() {
+	scope := &c.scopes[c.scopeIndex]
+	scope.tries = scope.tries[:len(scope.tries)-1]
+}
+
+func (c *Compiler) setTryHandler(handler bool) {
+	tries := c.scopes[c.scopeIndex].tries
+	tries[len(tries)-1].handler = handler
+}
+
+// compileBlockValue compiles a block so that it leaves the value of its last
+// expression on the stack, or null if it doesn't end in one.
+func (c *Compiler) compileBlockValue(block *ast.BlockStatement) error {
+	start := len(c.currentInstructions())
+	err := c.Compile(block)
+	if err != nil {
+		return err
+	}
+	last := c.scopes[c.scopeIndex].lastInstruction
+	if last.Opcode == code.OpPop && last.Position >= start {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+	return nil
+}
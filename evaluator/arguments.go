@@ -0,0 +1,146 @@
+package evaluator
+
+import (
+	"waiacig/ast"
+	"waiacig/object"
+)
+
+// keywordArgument is an argument passed by parameter name.
+type keywordArgument struct {
+	name  string
+	value object.Object
+}
+
+// evalArguments evaluates the arguments of a call, splitting off the
+// keyword arguments that follow the positional ones.
+func evalArguments(
+	exps []ast.Expression,
+	env *object.Environment,
+) ([]object.Object, []keywordArgument, object.Object) {
+	positional := exps
+	for i, exp := range exps {
+		if _, ok := exp.(*ast.KeywordArgument); ok {
+			positional = exps[:i]
+			break
+		}
+	}
+	args := evalExpressions(positional, env)
+	if len(args) == 1 && isError(args[0]) {
+		return nil, nil, args[0]
+	}
+	var keywords []keywordArgument
+	for _, exp := range exps[len(positional):] {
+		kw, ok := exp.(*ast.KeywordArgument)
+		if !ok {
+			return nil, nil, newError(object.ArityError,
+				"positional argument %s follows keyword argument", exp)
+		}
+		value := Eval(kw.Value, env)
+		if isError(value) {
+			return nil, nil, value
+		}
+		keywords = append(keywords, keywordArgument{name: kw.Name.Value, value: value})
+	}
+	return args, keywords, nil
+}
+
+// extendFunctionEnv binds the arguments of a call in a new environment
+// enclosed by the function's. Extra arguments to a variadic function are
+// collected into its rest parameter, and parameters the call doesn't supply
+// get their default values, evaluated in the new environment.
+func extendFunctionEnv(
+	fn *object.Function,
+	args []object.Object,
+	keywords []keywordArgument,
+) (*object.Environment, *object.Error) {
+	numParams := len(fn.Parameters)
+	numDefaults := 0
+	for _, def := range fn.Defaults {
+		if def != nil {
+			numDefaults++
+		}
+	}
+	numRequired := numParams - numDefaults
+	if len(args) > numParams && fn.Rest == nil ||
+		len(args) < numRequired && len(keywords) == 0 {
+		return nil, arityError(fn, numDefaults, len(args))
+	}
+
+	bound := make([]object.Object, numParams)
+	copy(bound, args)
+	for _, kw := range keywords {
+		index := -1
+		for i, param := range fn.Parameters {
+			if param.Value == kw.name {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			return nil, newError(object.ArityError, "unexpected keyword argument: %s", kw.name)
+		}
+		if bound[index] != nil {
+			return nil, newError(object.ArityError, "multiple values for argument: %s", kw.name)
+		}
+		bound[index] = kw.value
+	}
+
+	env := object.NewEnclosedEnvironment(fn.Env)
+	for i, param := range fn.Parameters {
+		if bound[i] != nil {
+			env.Set(param.Value, bound[i])
+		} else if i < numRequired {
+			return nil, newError(object.ArityError, "missing argument: %s", param.Value)
+		}
+	}
+	if fn.Rest != nil {
+		rest := []object.Object{}
+		if len(args) > numParams {
+			rest = append(rest, args[numParams:]...)
+		}
+		env.Set(fn.Rest.Value, &object.Array{Elements: rest})
+	}
+	for i, param := range fn.Parameters {
+		if bound[i] != nil {
+			continue
+		}
+		value := Eval(fn.Defaults[i], env)
+		if err, ok := value.(*object.Error); ok {
+			return nil, err
+		}
+		bound[i] = value
+		env.Set(param.Value, value)
+	}
+
+	for i, pattern := range fn.Patterns {
+		if pattern == nil {
+			continue
+		}
+		if err := destructure(pattern, bound[i], env); err != nil {
+			return nil, err
+		}
+	}
+	return env, nil
+}
+
+func arityError(fn *object.Function, numDefaults, got int) *object.Error {
+	numParams := len(fn.Parameters)
+	what := "wrong number of arguments"
+	if fn.Name != "" {
+		what += " to " + fn.Name
+	}
+	switch {
+	case fn.Rest != nil:
+		return newError(object.ArityError,
+			"%s: want=at least %d, got=%d",
+			what, numParams-numDefaults, got)
+	case numDefaults > 0:
+		return newError(object.ArityError,
+			"%s: want=%d to %d, got=%d",
+			what, numParams-numDefaults, numParams, got)
+	default:
+		return newError(object.ArityError,
+			"%s: want=%d, got=%d",
+			what, numParams, got)
+	}
+}
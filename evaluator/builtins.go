@@ -1,14 +1,17 @@
 package evaluator
 
-import (
-	"waiacig/object"
-)
-
-var builtins = map[string]*object.Builtin{
-	"len":   object.GetBuiltinByName("len"),
-	"puts":  object.GetBuiltinByName("puts"),
-	"first": object.GetBuiltinByName("first"),
-	"last":  object.GetBuiltinByName("last"),
-	"rest":  object.GetBuiltinByName("rest"),
-	"push":  object.GetBuiltinByName("push"),
+import "waiacig/object"
+
+// engine is the object.Context the evaluator runs builtins with, when
+// they're called in env.
+type engine struct {
+	env *object.Environment
+}
+
+func (e engine) Call(fn object.Object, args ...object.Object) object.Object {
+	return applyFunction(fn, args, nil, e.env)
+}
+
+func (e engine) Host() *object.Host {
+	return e.env.Host()
 }
@@ -1,15 +1,14 @@
 package evaluator
 
 import (
-	"fmt"
 	"waiacig/ast"
 	"waiacig/object"
 )
 
 var (
-	NULL  = &object.Null{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	NULL  = object.NULL
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
 )
 
 func Eval(node ast.Node, env *object.Environment) object.Object {
@@ -20,6 +19,8 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return &object.Integer{Value: node.Value}
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
+	case *ast.RegexLiteral:
+		return object.NewRegex(node.Pattern)
 	case *ast.Program:
 		return evalProgram(node, env)
 	case *ast.ExpressionStatement:
@@ -35,7 +36,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		case "-":
 			return evalMinusPrefixOperatorExpression(right)
 		default:
-			return newError("unknown operator: %s%s", node.Operator, right.Type())
+			return object.NewPrefixError(node.Operator, right)
 		}
 	case *ast.InfixExpression:
 		left := Eval(node.Left, env)
@@ -51,18 +52,17 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return evalIntegerInfixExpression(node.Operator, left, right)
 		case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 			return evalStringInfixExpression(node.Operator, left, right)
+		case left.Type() == object.REGEX_OBJ && right.Type() == object.REGEX_OBJ:
+			return evalRegexInfixExpression(node.Operator, left, right)
 		case node.Operator == "==":
 			return nativeBoolToBooleanObject(left == right)
 		case node.Operator == "!=":
 			return nativeBoolToBooleanObject(left != right)
-		case left.Type() != right.Type():
-			return newError("type mismatch: %s %s %s",
-				left.Type(), node.Operator, right.Type())
 		default:
-			return newError("unknown operator: %s %s %s", left.Type(), node.Operator, right.Type())
+			return object.NewInfixError(left, node.Operator, right)
 		}
 	case *ast.BlockStatement:
-		return evalBlockStatement(node, env)
+		return evalBlockStatement(node, object.NewBlockEnvironment(env))
 	case *ast.IfExpression:
 		return evalIfExpression(node, env)
 	case *ast.ReturnStatement:
@@ -71,18 +71,68 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
+	case *ast.ThrowStatement:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		return object.Throw(val)
+	case *ast.TryExpression:
+		return evalTryExpression(node, env)
+	case *ast.YieldExpression:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		if node.Delegate {
+			return evalYieldDelegate(val, env)
+		}
+		return evalYield(val, env)
 	case *ast.LetStatement:
 		val := Eval(node.Value, env)
 		if isError(val) {
 			return val
 		}
-		env.Set(node.Name.Value, val)
+		if node.Pattern != nil {
+			if err := destructure(node.Pattern, val, env); err != nil {
+				return err
+			}
+			return nil
+		}
+		if env.IsConst(node.Name.Value) {
+			return newError(object.TypeError, "cannot redeclare constant %s", node.Name.Value)
+		}
+		if node.Const {
+			env.SetConst(node.Name.Value, val)
+		} else {
+			env.Set(node.Name.Value, val)
+		}
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Env: env, Body: body}
+		return &object.Function{
+			Parameters:  params,
+			Patterns:    node.Patterns,
+			Defaults:    node.Defaults,
+			Rest:        node.Rest,
+			Env:         env,
+			Body:        body,
+			IsGenerator: node.IsGenerator,
+			Name:        node.Name,
+		}
+	case *ast.FunctionStatement:
+		// Bound by hoistFunctions before the statements around it.
+		return nil
+	case *ast.MethodExpression:
+		return evalMethodExpression(node, env)
+	case *ast.ImportExpression:
+		importer := env.Importer()
+		if importer == nil {
+			return newError(object.ImportError, "cannot import %s: no module loader", node.Path)
+		}
+		return importer.Import(node.Path)
 	case *ast.CallExpression:
 		if node.Function.TokenLiteral() == "quote" {
 			return quote(node.Arguments[0], env)
@@ -91,11 +141,11 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(function) {
 			return function
 		}
-		args := evalExpressions(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
-			return args[0]
+		args, keywords, err := evalArguments(node.Arguments, env)
+		if err != nil {
+			return err
 		}
-		return applyFunction(function, args)
+		return applyFunction(function, args, keywords, env)
 	case *ast.ArrayLiteral:
 		elements := evalExpressions(node.Elements, env)
 		if len(elements) == 1 && isError(elements[0]) {
@@ -112,13 +162,46 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return index
 		}
 		return evalIndexExpression(left, index)
+	case *ast.AssignExpression:
+		return evalAssignExpression(node, env)
+	case *ast.SliceExpression:
+		left := Eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+		bounds := []object.Object{NULL, NULL, NULL}
+		for i, bound := range []ast.Expression{node.Start, node.End, node.Step} {
+			if bound == nil {
+				continue
+			}
+			bounds[i] = Eval(bound, env)
+			if isError(bounds[i]) {
+				return bounds[i]
+			}
+		}
+		return object.Slice(left, bounds[0], bounds[1], bounds[2])
+	case *ast.RangeExpression:
+		start := Eval(node.Start, env)
+		if isError(start) {
+			return start
+		}
+		end := Eval(node.End, env)
+		if isError(end) {
+			return end
+		}
+		return object.NewRange(start, end)
 	case *ast.HashLiteral:
 		return evalHashLiteral(node, env)
+	case *ast.MatchExpression:
+		return evalMatchExpression(node, env)
 	}
 	return nil
 }
 
 func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+	if err := hoistFunctions(program.Statements, env); err != nil {
+		return err
+	}
 	var result object.Object
 	for _, statement := range program.Statements {
 		result = Eval(statement, env)
@@ -133,6 +216,9 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 }
 
 func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+	if err := hoistFunctions(block.Statements, env); err != nil {
+		return err
+	}
 	var result object.Object
 	for _, statement := range block.Statements {
 		result = Eval(statement, env)
@@ -146,6 +232,31 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 	return result
 }
 
+// hoistFunctions binds the functions declared among statements in env
+// before any of the statements run, so that they can call each other
+// whatever their order. A function can't have the name of a const bound
+// among the statements, wherever the const is.
+func hoistFunctions(statements []ast.Statement, env *object.Environment) *object.Error {
+	consts := map[string]bool{}
+	for _, statement := range statements {
+		if let, ok := statement.(*ast.LetStatement); ok && let.Const && let.Name != nil {
+			consts[let.Name.Value] = true
+		}
+	}
+	for _, statement := range statements {
+		declaration, ok := statement.(*ast.FunctionStatement)
+		if !ok {
+			continue
+		}
+		name := declaration.Name.Value
+		if env.IsConst(name) || consts[name] {
+			return newError(object.TypeError, "cannot redeclare constant %s", name)
+		}
+		env.Set(name, Eval(declaration.Function, env))
+	}
+	return nil
+}
+
 func evalIdentifier(
 	node *ast.Identifier,
 	env *object.Environment,
@@ -153,10 +264,10 @@ func evalIdentifier(
 	if val, ok := env.Get(node.Value); ok {
 		return val
 	}
-	if builtin, ok := builtins[node.Value]; ok {
+	if builtin := env.Host().Lookup(node.Value); builtin != nil {
 		return builtin
 	}
-	return newError("identifier not found: " + node.Value)
+	return newError(object.NameError, "identifier not found: "+node.Value)
 }
 
 func evalBangOperatorExpression(right object.Object) object.Object {
@@ -174,9 +285,7 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
 	if right.Type() != object.INTEGER_OBJ {
-		if right.Type() != object.INTEGER_OBJ {
-			return newError("unknown operator: -%s", right.Type())
-		}
+		return object.NewPrefixError("-", right)
 	}
 	value := right.(*object.Integer).Value
 	return &object.Integer{Value: -value}
@@ -205,8 +314,7 @@ func evalIntegerInfixExpression(operator string,
 	case "!=":
 		return nativeBoolToBooleanObject(leftVal != rightVal)
 	default:
-		return newError("unknown operator: %s %s %s",
-			left.Type(), operator, right.Type())
+		return object.NewInfixError(left, operator, right)
 	}
 }
 
@@ -214,13 +322,30 @@ func evalStringInfixExpression(operator string,
 	left, right object.Object,
 ) object.Object {
 	if operator != "+" {
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return object.NewInfixError(left, operator, right)
 	}
 	leftVal := left.(*object.String).Value
 	rightVal := right.(*object.String).Value
 	return &object.String{Value: leftVal + rightVal}
 }
 
+// evalRegexInfixExpression compares regexes by their patterns, as each
+// evaluation of a regex literal creates a new one.
+func evalRegexInfixExpression(operator string,
+	left, right object.Object,
+) object.Object {
+	leftVal := left.(*object.Regex).Regexp.String()
+	rightVal := right.(*object.Regex).Regexp.String()
+	switch operator {
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return object.NewInfixError(left, operator, right)
+	}
+}
+
 func nativeBoolToBooleanObject(input bool) *object.Boolean {
 	if input {
 		return TRUE
@@ -242,14 +367,53 @@ func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Obje
 	}
 }
 
+func evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	if target, ok := node.Target.(*ast.IndexExpression); ok {
+		left := Eval(target.Left, env)
+		if isError(left) {
+			return left
+		}
+		index := Eval(target.Index, env)
+		if isError(index) {
+			return index
+		}
+		value := Eval(node.Value, env)
+		if isError(value) {
+			return value
+		}
+		return object.SetIndex(left, index, value)
+	}
+	value := Eval(node.Value, env)
+	if isError(value) {
+		return value
+	}
+	name := node.Target.(*ast.Identifier).Value
+	if env.Host().Lookup(name) != nil {
+		if _, bound := env.Get(name); !bound {
+			return newError(object.NameError, "cannot assign to builtin %s", name)
+		}
+	}
+	return env.Assign(name, value)
+}
+
 func evalIndexExpression(left, index object.Object) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalArrayIndexExpression(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
+	case left.Type() == object.EXCEPTION_OBJ && index.Type() == object.STRING_OBJ:
+		return evalExceptionIndexExpression(left, index)
+	case left.Type() == object.RANGE_OBJ && index.Type() == object.INTEGER_OBJ:
+		value, ok := left.(*object.Range).Index(index.(*object.Integer).Value)
+		if !ok {
+			return NULL
+		}
+		return &object.Integer{Value: value}
+	case left.Type() == object.MODULE_OBJ && index.Type() == object.STRING_OBJ:
+		return left.(*object.Module).Member(index.(*object.String).Value)
 	default:
-		return newError("index operator not supported: %s", left.Type())
+		return newError(object.TypeError, "index operator not supported: %s", left.Type())
 	}
 }
 
@@ -267,7 +431,7 @@ func evalHashIndexExpression(hash, index object.Object) object.Object {
 	hashObject := hash.(*object.Hash)
 	key, ok := index.(object.Hashable)
 	if !ok {
-		return newError("unusable as hash key: %s", index.Type())
+		return newError(object.TypeError, "unusable as hash key: %s", index.Type())
 	}
 	pair, ok := hashObject.Pairs[key.HashKey()]
 	if !ok {
@@ -276,6 +440,18 @@ func evalHashIndexExpression(hash, index object.Object) object.Object {
 	return pair.Value
 }
 
+func evalExceptionIndexExpression(exception, index object.Object) object.Object {
+	ex := exception.(*object.Exception)
+	switch index.(*object.String).Value {
+	case "kind":
+		return &object.String{Value: ex.Kind}
+	case "message":
+		return &object.String{Value: ex.Message}
+	default:
+		return NULL
+	}
+}
+
 func isTruthy(obj object.Object) bool {
 	switch obj {
 	case NULL:
@@ -289,8 +465,8 @@ func isTruthy(obj object.Object) bool {
 	}
 }
 
-func newError(format string, a ...interface{}) *object.Error {
-	return &object.Error{Message: fmt.Sprintf(format, a...)}
+func newError(kind string, format string, a ...interface{}) *object.Error {
+	return object.NewError(kind, format, a...)
 }
 
 func isError(obj object.Object) bool {
@@ -306,6 +482,25 @@ func evalExpressions(
 ) []object.Object {
 	var result []object.Object
 	for _, e := range exps {
+		if spread, ok := e.(*ast.SpreadElement); ok {
+			evaluated := Eval(spread.Value, env)
+			if isError(evaluated) {
+				return []object.Object{evaluated}
+			}
+			switch evaluated := evaluated.(type) {
+			case *object.Array:
+				result = append(result, evaluated.Elements...)
+			case *object.Range:
+				elements, err := evaluated.Elements()
+				if err != nil {
+					return []object.Object{err}
+				}
+				result = append(result, elements...)
+			default:
+				return []object.Object{newError(object.TypeError, "cannot spread %s", evaluated.Type())}
+			}
+			continue
+		}
 		evaluated := Eval(e, env)
 		if isError(evaluated) {
 			return []object.Object{evaluated}
@@ -315,31 +510,43 @@ func evalExpressions(
 	return result
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
-	switch fn := fn.(type) {
-	case *object.Function:
-		extendedEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
-		return unwrapReturnValue(evaluated)
-	case *object.Builtin:
-		if result := fn.Fn(args...); result != nil {
-			return result
-		}
-		return NULL
-	default:
-		return newError("not a function: %s", fn.Type())
-	}
-}
-
-func extendFunctionEnv(
-	fn *object.Function,
+func applyFunction(
+	fn object.Object,
 	args []object.Object,
-) *object.Environment {
-	env := object.NewEnclosedEnvironment(fn.Env)
-	for paramIdx, param := range fn.Parameters {
-		env.Set(param.Value, args[paramIdx])
+	keywords []keywordArgument,
+	env *object.Environment,
+) object.Object {
+	for {
+		switch function := fn.(type) {
+		case *object.Function:
+			extendedEnv, err := extendFunctionEnv(function, args, keywords)
+			if err != nil {
+				return err
+			}
+			if function.IsGenerator {
+				return newGenerator(function.Body, extendedEnv)
+			}
+			evaluated := evalTailBlock(function.Body, extendedEnv, true)
+			evaluated = unwrapReturnValue(evaluated)
+			call, ok := evaluated.(*tailCall)
+			if !ok {
+				return evaluated
+			}
+			fn, args, keywords = call.fn, call.args, call.keywords
+		case *object.Builtin:
+			if len(keywords) > 0 {
+				return newError(object.ArityError, "keyword arguments not supported by builtin functions")
+			}
+			if result := function.Call(engine{env}, args...); result != nil {
+				return result
+			}
+			return NULL
+		case *boundMethod:
+			fn, args = function.method, append([]object.Object{function.receiver}, args...)
+		default:
+			return newError(object.TypeError, "not a function: %s", fn.Type())
+		}
 	}
-	return env
 }
 
 func unwrapReturnValue(obj object.Object) object.Object {
@@ -352,22 +559,21 @@ func unwrapReturnValue(obj object.Object) object.Object {
 func evalHashLiteral(
 	node *ast.HashLiteral, env *object.Environment,
 ) object.Object {
-	pairs := make(map[object.HashKey]object.HashPair)
-	for keyNode, valueNode := range node.Pairs {
+	hash := object.NewHash()
+	for _, keyNode := range node.Keys {
 		key := Eval(keyNode, env)
 		if isError(key) {
 			return key
 		}
 		hashKey, ok := key.(object.Hashable)
 		if !ok {
-			return newError("unusable as hash key: %s", key.Type())
+			return newError(object.TypeError, "unusable as hash key: %s", key.Type())
 		}
-		value := Eval(valueNode, env)
+		value := Eval(node.Pairs[keyNode], env)
 		if isError(value) {
 			return value
 		}
-		hashed := hashKey.HashKey()
-		pairs[hashed] = object.HashPair{Key: key, Value: value}
+		hash.Set(hashKey.HashKey(), object.HashPair{Key: key, Value: value})
 	}
-	return &object.Hash{Pairs: pairs}
+	return hash
 }
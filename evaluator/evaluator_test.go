@@ -1,7 +1,12 @@
 package evaluator
 
 import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"waiacig/lexer"
 	"waiacig/object"
@@ -154,6 +159,35 @@ func testNullObject(t *testing.T, obj object.Object) bool {
 	return true
 }
 
+// testExpected checks obj against expected: an int, bool or nil is checked
+// as that value, a string against obj's Inspect and an *object.Error by its
+// message.
+func testExpected(t *testing.T, obj object.Object, expected interface{}) {
+	t.Helper()
+	switch expected := expected.(type) {
+	case int:
+		testIntegerObject(t, obj, int64(expected))
+	case bool:
+		testBooleanObject(t, obj, expected)
+	case nil:
+		testNullObject(t, obj)
+	case string:
+		if obj.Inspect() != expected {
+			t.Errorf("wrong result. expected=%q, got=%q", expected, obj.Inspect())
+		}
+	case *object.Error:
+		errObj, ok := obj.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error. got=%T (%+v)", obj, obj)
+			return
+		}
+		if errObj.Message != expected.Message {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				expected.Message, errObj.Message)
+		}
+	}
+}
+
 func TestReturnStatements(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -319,7 +353,7 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("")`, 0},
 		{`len("four")`, 4},
 		{`len("hello world")`, 11},
-		{`len(1)`, "argument to `len` not supported, got INTEGER"}, {`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
+		{`len(1)`, "argument to `len` must be ARRAY, STRING, RANGE or HASH, got INTEGER"}, {`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
@@ -476,3 +510,773 @@ func TestHashIndexExpressions(t *testing.T) {
 		}
 	}
 }
+
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{
+			`
+			let countDown = fn(x) {
+				if (x == 0) {
+					return 0;
+				}
+				countDown(x - 1);
+			};
+			countDown(1000000);
+			`,
+			0,
+		},
+		{
+			`
+			let sum = fn(n, acc) {
+				if (n == 0) { acc } else { sum(n - 1, acc + n) }
+			};
+			sum(10000, 0);
+			`,
+			50005000,
+		},
+		{
+			`
+			let sum = fn(n, acc) {
+				if (n == 0) { acc } else { sum(...[n - 1], acc: acc + n) }
+			};
+			sum(100000, 0);
+			`,
+			5000050000,
+		},
+		{
+			`
+			let g = fn(n, ...r) {
+				if (n == 0) { len(r) } else { g(n - 1, ...r, n) }
+			};
+			g(1000, 7);
+			`,
+			1001,
+		},
+		{
+			`
+			let wrap = fn(x) { len(x) };
+			wrap([1, 2, 3]);
+			`,
+			3,
+		},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestMatchExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`match (1) { 1 => 10, _ => 20 }`, 10},
+		{`match (2) { 1 => 10, _ => 20 }`, 20},
+		{`match ("b") { "a" => 1, "b" => 2 }`, 2},
+		{`match (true) { false => 1, true => 2 }`, 2},
+		{`match (-1) { -1 => 1, _ => 2 }`, 1},
+		{`match (5) { x if x > 3 => x * 2, x => x }`, 10},
+		{`match (2) { x if x > 3 => x * 2, x => x }`, 2},
+		{`match ([1, 2]) { [a] => a, [a, b] => a + b }`, 3},
+		{`match ([1, 2, 3]) { [a, ...rest] => len(rest) }`, 2},
+		{`match ([[1, 2], 3]) { [[a, b], c] => a + b + c }`, 6},
+		{`match ({"r": 3}) { {"s": s} => s, {"r": r} => r * r }`, 9},
+		{`match ("1") { 1 => 1, _ => 2 }`, 2},
+		{
+			`let sum = fn(xs) { match (xs) { [] => 0, [h, ...t] => h + sum(t) } };
+			sum([1, 2, 3, 4])`,
+			10,
+		},
+		{`match (3) { 1 => 1, 2 => 2 }`, &object.Error{Message: "no match arm for value: 3"}},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testExpected(t, evaluated, tt.expected)
+	}
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let [a, b] = [1, 2]; a + b`, 3},
+		{`let [a, ...rest] = [1, 2, 3]; len(rest)`, 2},
+		{`let [[a, b], c] = [[1, 2], 3]; a + b + c`, 6},
+		{`let {"x": x, "y": y} = {"x": 1, "y": 2}; x * 10 + y`, 12},
+		{`let {name, age} = {"name": "ann", "age": 30}; age`, 30},
+		{`let f = fn([a, b], c) { a + b + c }; f([1, 2], 3)`, 6},
+		{`let f = fn({x, y}) { x - y }; f({"x": 5, "y": 2})`, 3},
+		{`let [a, b] = [1];`, &object.Error{Message: "cannot destructure [1] into [a, b]"}},
+		{`let {x} = 5;`, &object.Error{Message: "cannot destructure 5 into {x: x}"}},
+		{`let f = fn([a]) { a }; f([1, 2])`, &object.Error{Message: "cannot destructure [1, 2] into [a]"}},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testExpected(t, evaluated, tt.expected)
+	}
+}
+
+func TestDefaultsVariadicsAndSpread(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let f = fn(a, b = 10) { a + b }; f(1)`, 11},
+		{`let f = fn(a, b = 10) { a + b }; f(1, 2)`, 3},
+		{`let f = fn(a, b = a * 2) { a + b }; f(3)`, 9},
+		{`let f = fn(a = 1, b = 2) { a * 10 + b }; f(b: 5)`, 15},
+		{`let f = fn(a, b, c) { a * 100 + b * 10 + c }; f(1, c: 3, b: 2)`, 123},
+		{`let f = fn(a, ...rest) { len(rest) }; f(1, 2, 3)`, 2},
+		{`let f = fn(...xs) { len(xs) }; f(...[1, 2], 3, ...[4])`, 4},
+		{`let f = fn(a, b) { a - b }; f(...[5, 3])`, 2},
+		{`len([0, ...[1, 2], 3])`, 4},
+		{`let f = fn([a, b] = [1, 2]) { a + b }; f()`, 3},
+		{
+			`let count = fn(n, acc = 0) { if (n == 0) { acc } else { count(n - 1, acc + 1) } };
+			count(1000)`,
+			1000,
+		},
+		{`fn(a, b) { a + b }(1)`, &object.Error{Message: "wrong number of arguments: want=2, got=1"}},
+		{`fn(a, b = 1) { a + b }(1, 2, 3)`, &object.Error{Message: "wrong number of arguments: want=1 to 2, got=3"}},
+		{`fn(a, ...rest) { a }()`, &object.Error{Message: "wrong number of arguments: want=at least 1, got=0"}},
+		{`fn(a, b) { a + b }(b: 1)`, &object.Error{Message: "missing argument: a"}},
+		{`fn(a) { a }(1, a: 2)`, &object.Error{Message: "multiple values for argument: a"}},
+		{`fn(a) { a }(b: 2)`, &object.Error{Message: "unexpected keyword argument: b"}},
+		{`len(x: [1])`, &object.Error{Message: "keyword arguments not supported by builtin functions"}},
+		{`[...1]`, &object.Error{Message: "cannot spread INTEGER"}},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testExpected(t, evaluated, tt.expected)
+	}
+}
+
+func TestTryCatchThrow(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`try { 1 } catch (e) { 2 }`, 1},
+		{`try { throw 5; 1 } catch (e) { e + 1 }`, 6},
+		{`try { throw 1 } catch { 7 }`, 7},
+		{`try { len(1) } catch (e) { e["kind"] }`, "TypeError"},
+		{`try { len(1) } catch (e) { e["message"] }`, "argument to `len` must be ARRAY, STRING, RANGE or HASH, got INTEGER"},
+		{`try { fn(a) { a }() } catch (e) { e["kind"] }`, "ArityError"},
+		{`try { 1 + true } catch (e) { e["kind"] }`, "TypeError"},
+		{`try { 1 + "a" } catch (e) { e["message"] }`, "type mismatch: INTEGER + STRING"},
+		{`try { "a" - "b" } catch (e) { e["message"] }`, "unknown operator: STRING - STRING"},
+		{`try { 1 > true } catch (e) { e["message"] }`, "type mismatch: INTEGER > BOOLEAN"},
+		{`try { -"a" } catch (e) { e["message"] }`, "unknown operator: -STRING"},
+		{`1 == "a"`, false},
+		{`try { x } catch (e) { e["kind"] }`, "NameError"},
+		{`try { match (1) { 2 => 2 } } catch (e) { e["kind"] }`, "MatchError"},
+		{`1 + try { throw 2 } catch (e) { e }`, 3},
+		{
+			`let f = fn() { throw "boom" };
+			let g = fn() { f() + 1 };
+			try { g() } catch (e) { e }`,
+			"boom",
+		},
+		{`try { try { throw 1 } catch (e) { throw e + 1 } } catch (e) { e * 10 }`, 20},
+		{`try { try { throw 1 } finally { 5 } } catch (e) { e }`, 1},
+		{`try { try { len(1) } catch (e) { throw e } } catch (e) { e["kind"] }`, "TypeError"},
+		{`let f = fn() { try { return 1 } finally { 2 } }; f()`, 1},
+		{`let f = fn() { try { return 1 } finally { return 2 } }; f()`, 2},
+		{`let f = fn() { try { throw 1 } finally { return 2 } }; f()`, 2},
+		{
+			`let f = fn() { try { throw 1 } catch (e) { throw e + 1 } finally { 0 } };
+			try { f() } catch (e) { e }`,
+			2,
+		},
+		{`throw "boom"`, &object.Error{Message: "boom"}},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testExpected(t, evaluated, tt.expected)
+	}
+}
+
+func TestGenerators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let gen = fn() { yield 1; yield 2; }; let g = gen(); next(g) + next(g)`, 3},
+		{`let gen = fn() { yield 1; }; let g = gen(); next(g); next(g)`, nil},
+		{`let gen = fn() { yield 1; }; let g = gen(); next(g); next(g); next(g)`, nil},
+		{`let gen = fn(a, b = 10) { yield a; yield b; }; let g = gen(1); next(g); next(g)`, 10},
+		{
+			`let gen = fn(n) { yield n; yield n + 1 };
+			let a = gen(1);
+			let b = gen(10);
+			next(a); next(b);
+			next(a) + next(b)`,
+			13,
+		},
+		{
+			`let naturals = fn(n) { yield n; yield* naturals(n + 1) };
+			let take = fn(g, n) {
+				if (n == 0) { [] } else { let x = next(g); [x, ...take(g, n - 1)] }
+			};
+			let xs = take(naturals(5), 3);
+			xs[0] * 100 + xs[1] * 10 + xs[2]`,
+			567,
+		},
+		{`let gen = fn() { yield 1; throw "late" }; next(gen())`, 1},
+		{
+			`let gen = fn() { yield 1; throw "late" };
+			let g = gen();
+			next(g);
+			try { next(g) } catch (e) { e }`,
+			"late",
+		},
+		{
+			`let gen = fn() { try { yield 1; throw "x" } catch (e) { yield e } };
+			let g = gen();
+			next(g);
+			next(g)`,
+			"x",
+		},
+		{`let g = fn() { yield 1 }; let f = fn() { g() }; next(f())`, 1},
+		{`let gen = fn(a) { yield a }; try { gen() } catch (e) { e["kind"] }`, "ArityError"},
+		{`next(1)`, &object.Error{Message: "argument to `next` must be an iterator, got INTEGER"}},
+		{`let gen = fn() { yield* 5 }; next(gen())`, &object.Error{Message: "cannot iterate over INTEGER"}},
+		{`let gen = fn() { yield* [1, 2]; yield 3 }; let g = gen(); next(g) * 100 + next(g) * 10 + next(g)`, 123},
+		{`let gen = fn() { yield* [] }; next(gen())`, nil},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testExpected(t, evaluated, tt.expected)
+	}
+}
+
+func TestGeneratorGoroutines(t *testing.T) {
+	before := runtime.NumGoroutine()
+	for i := 0; i < 20; i++ {
+		testEval(`let gen = fn() { yield 1; yield 2; }; gen(); next(gen())`)
+		testEval(`let gen = fn() { yield 1; }; let g = gen(); next(g); next(g)`)
+	}
+	for i := 0; i < 100 && runtime.NumGoroutine() > before; i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("generators left %d goroutines running", n-before)
+	}
+}
+
+func TestDotAccessAndMethodCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let p = {"name": "ann"}; p.name`, "ann"},
+		{`let h = {"inner": {"v": 7}}; h.inner.v`, 7},
+		{`let p = {"n": 2, "times": fn(self, x) { self.n * x }}; p.times(5)`, 10},
+		{`[1, 2, 3].len()`, 3},
+		{`[1, 2].push(3).rest().first()`, 2},
+		{`let h = {"len": fn(self) { 42 }}; h.len()`, 42},
+		{`let h = {"f": fn(self, a, b = 1) { a + b }}; h.f(...[1], b: 9)`, 10},
+		{
+			`let h = {"count": fn(self, n) { if (n == 0) { 0 } else { self.count(n - 1) } }};
+			h.count(100000)`,
+			0,
+		},
+		{`5.foo()`, &object.Error{Message: "undefined method foo for INTEGER"}},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testExpected(t, evaluated, tt.expected)
+	}
+}
+
+func TestSlicesAndRanges(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`len([1, 2, 3, 4, 5][1:3])`, 2},
+		{`[1, 2, 3, 4, 5][-2:][0]`, 4},
+		{`[1, 2, 3, 4, 5][::-1][0]`, 5},
+		{`len([1, 2, 3, 4, 5][::2])`, 3},
+		{`"hello"[1:-1]`, "ell"},
+		{`"hello"[::-1]`, "olleh"},
+		{`len(0..1000000000)`, 1000000000},
+		{`(0..10)[3]`, 3},
+		{`(0..10)[::3][3]`, 9},
+		{`len([...(0..4)])`, 4},
+		{`let g = fn() { yield* 2..5 }; let it = g(); next(it) + next(it) + next(it)`, 9},
+		{`[1, 2][::0]`, &object.Error{Message: "slice step cannot be zero"}},
+		{`5[1:2]`, &object.Error{Message: "slice operator not supported: INTEGER"}},
+		{`1.."a"`, &object.Error{Message: "range bounds must be INTEGER, got INTEGER and STRING"}},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testExpected(t, evaluated, tt.expected)
+	}
+}
+
+func TestAssignmentsAndConst(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let x = 1; x = x + 1; x`, 2},
+		{`let a = 1; let b = 2; a = b = 7; a + b`, 14},
+		{`let f = fn() { let n = 1; n = n * 5; n }; f()`, 5},
+		{`let total = 0; let add = fn(n) { total = total + n }; add(2); add(3); total`, 5},
+		{`const limit = 10; limit * 2`, 20},
+		{`let xs = [1, 2, 3]; xs[0] = 9; xs[0]`, 9},
+		{`let xs = [1, 2, 3]; let ys = xs[:2]; ys[0] = 9; xs[0]`, 1},
+		{`let h = {"a": 1}; h.b = 2; h["b"] + h.a`, 3},
+		{`const a = 1; a = 2`, &object.Error{Message: "cannot assign to constant a"}},
+		{`const a = 1; let a = 2`, &object.Error{Message: "cannot redeclare constant a"}},
+		{`b = 1`, &object.Error{Message: "cannot assign to undefined variable b"}},
+		{`len = 1`, &object.Error{Message: "cannot assign to builtin len"}},
+		{
+			`let f = fn() { let n = 0; let g = fn() { n = 1 }; g() }; f()`,
+			&object.Error{Message: "cannot assign to captured variable n"},
+		},
+		{`let c = freeze({"xs": [1, 2]}); c.xs[0] = 5`, &object.Error{Message: "cannot modify frozen ARRAY"}},
+		{`let c = freeze([{"a": 1}]); c[0].a = 5`, &object.Error{Message: "cannot modify frozen HASH"}},
+		{`let a = [1]; a[0] = a; len(freeze(a))`, 1},
+		{`let h = {}; h.self = h; freeze(h); h.self.x = 1`, &object.Error{Message: "cannot modify frozen HASH"}},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testExpected(t, evaluated, tt.expected)
+	}
+}
+
+func TestFunctionDeclarations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`isEven(10); fn isEven(n) { if (n == 0) { true } else { isOdd(n - 1) } } fn isOdd(n) { if (n == 0) { false } else { isEven(n - 1) } } isOdd(7)`, true},
+		{`let f = fn(x) { fn even(n) { if (n == 0) { true } else { odd(n - 1) } } fn odd(n) { if (n == 0) { false } else { even(n - 1) } } even(x) }; f(8)`, true},
+		{`let f = fn() { let r = fact(5); fn fact(n) { if (n < 2) { 1 } else { n * fact(n - 1) } } r }; f()`, 120},
+		{`let f = fn(base) { fn count(n) { if (n == 0) { base } else { count(n - 1) + 1 } } count(3) }; f(10)`, 13},
+		{`let f = fn() { fn a() { b() } let k = fn() { a() }; fn b() { 42 } k() }; f()`, 42},
+		{`if (true) { fn square(x) { x * x } square(9) }`, 81},
+		{`let x = 1; fn g() { x } g()`, 1},
+		{`let f = fn() { let x = 10; fn g() { x } g() }; f()`, 10},
+		{`let x = 1; let f = fn() { fn g() { x } let x = 2; g() }; f()`, 2},
+		{`let f = fn() { fn g() { x + h() } let x = 2; fn h() { x * 10 } let x = 3; g() }; f()`, 33},
+		{`let f = fn() { let x = 5; fn g() { x } let x = x + 1; g() }; f()`, 6},
+		{`fn add(a, b) { a + b } add(1)`, &object.Error{Message: "wrong number of arguments to add: want=2, got=1"}},
+		{`fn add(a, b = 1) { a + b } add()`, &object.Error{Message: "wrong number of arguments to add: want=1 to 2, got=0"}},
+		{`const a = 1; fn a() { 2 } a`, &object.Error{Message: "cannot redeclare constant a"}},
+		{`fn a() { 2 } const a = 1; a`, &object.Error{Message: "cannot redeclare constant a"}},
+		{`let f = fn() { const a = 1; fn a() { 2 } a }; f()`, &object.Error{Message: "cannot redeclare constant a"}},
+		{`fn g() { k } let r = try { g() } catch (e) { e.message }; let k = 7; r + " " + str(g())`, "identifier not found: k 7"},
+		{`let f = fn() { fn g() { k } let r = g(); let k = 7; r }; f()`, &object.Error{Message: "identifier not found: k"}},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testExpected(t, evaluated, tt.expected)
+	}
+}
+
+func TestHigherOrderBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`map([1, 2, 3], fn(x) { x * 2 })`, "[2, 4, 6]"},
+		{`[1, 2, 3, 4].filter(|x| x > 2)`, "[3, 4]"},
+		{`reduce([1, 2, 3], |acc, x| acc + x)`, 6},
+		{`reduce(1..5, |acc, x| acc + x, 100)`, 110},
+		{`let n = 0; each([1, 2, 3], fn(x) { n = n + x }); n`, 6},
+		{`any([1, 2], |x| x > 1)`, true},
+		{`all([1, 2], |x| x > 1)`, false},
+		{`find([1, 2, 3], |x| x > 1)`, 2},
+		{`find([1, 2, 3], |x| x > 5)`, nil},
+		{`sort_by(["b", "c", "a"], |x| x)`, "[a, b, c]"},
+		{`[[2, 1], [1, 2], [2, 3]].sort_by(|p| p[0]).map(|p| p[1])`, "[2, 1, 3]"},
+		{`let gen = fn() { yield 1; yield 2 }; map(gen(), |x| x * 3)`, "[3, 6]"},
+		{`try { map([1, 2], fn(x) { throw x }) } catch (e) { e + 100 }`, 101},
+		{`reduce([], |a, b| a + b)`, &object.Error{Message: "reduce of empty ARRAY with no initial value"}},
+		{`map(1, |x| x)`, &object.Error{Message: "argument to `map` must be iterable, got INTEGER"}},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testExpected(t, evaluated, tt.expected)
+	}
+}
+
+func TestHashBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`{"b": 1, "a": 2, 3: [1], true: 4}`, "{b: 1, a: 2, 3: [1], true: 4}"},
+		{`let h = {"b": 1}; h.a = 2; h.b = 3; h`, "{b: 3, a: 2}"},
+		{`keys({"b": 1, "a": 2})`, "[b, a]"},
+		{`values({"b": 1, "a": 2})`, "[1, 2]"},
+		{`items({"b": 1, "a": 2})`, "[[b, 1], [a, 2]]"},
+		{`len({"a": 1, "b": 2})`, 2},
+		{`has({"a": 1}, "a")`, true},
+		{`{"a": 1}.has("b")`, false},
+		{`let h = {"a": 1, "b": 2}; [delete(h, "a"), h]`, "[{b: 2}, {a: 1, b: 2}]"},
+		{`merge({"x": 1, "y": 2}, {"z": 3, "x": 9})`, "{x: 9, y: 2, z: 3}"},
+		{`has({}, [1])`, &object.Error{Message: "unusable as hash key: ARRAY"}},
+		{`keys([1])`, &object.Error{Message: "argument to `keys` must be HASH, got ARRAY"}},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testExpected(t, evaluated, tt.expected)
+	}
+}
+
+func TestStringBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`join(split("a,b,,c", ","), "-")`, "a-b--c"},
+		{`len(split("a b c", " "))`, 3},
+		{`trim("  hi  ") + "|"`, "hi|"},
+		{`trim_left("  hi  ") + "|"`, "hi  |"},
+		{`trim_right("  hi  ") + "|"`, "  hi|"},
+		{`"hello world".replace("o", "0")`, "hell0 w0rld"},
+		{`contains("abc", "b")`, true},
+		{`"abc".starts_with("ab")`, true},
+		{`"abc".ends_with("ab")`, false},
+		{`index_of("abc", "c")`, 2},
+		{`index_of("abc", "z")`, -1},
+		{`upper("MiXed") + lower("MiXed")`, "MIXEDmixed"},
+		{`"ab".repeat(3)`, "ababab"},
+		{`substr("hello", 1)`, "ello"},
+		{`substr("hello", 1, 3)`, "ell"},
+		{`substr("hello", -3, 2)`, "ll"},
+		{`substr("hello", 2, 100)`, "llo"},
+		{`substr("hello", 1, 9223372036854775807)`, "ello"},
+		{`join(chars("héllo"), "|")`, "h|é|l|l|o"},
+		{`format("%s has %d items: %v", "list", 3, [1, "a"])`, "list has 3 items: [1, a]"},
+		{`format("%q %t %5.1s|%-4d|%x %%", "q", true, "abc", 7, 255)`, "\"q\" true     a|7   |ff %"},
+		{`format("%d", "x")`, &object.Error{Message: "format verb %d not supported for STRING"}},
+		{`format("%d %d", 1)`, &object.Error{Message: "format has no argument for %d"}},
+		{`format("%d", 1, 2)`, &object.Error{Message: "format has 1 arguments left over"}},
+		{`format("%z", 1)`, &object.Error{Message: "unknown format verb %z"}},
+		{`join([1], ",")`, &object.Error{Message: "elements joined by `join` must be STRING, got INTEGER"}},
+		{`replace("a", 1, "b")`, &object.Error{Message: "argument 2 to `replace` must be STRING, got INTEGER"}},
+		{`upper(1)`, &object.Error{Message: "argument to `upper` must be STRING, got INTEGER"}},
+		{`upper("a", "b")`, &object.Error{Message: "wrong number of arguments. got=2, want=1"}},
+		{`repeat("a", -1)`, &object.Error{Message: "repeat count must not be negative, got -1"}},
+		{`repeat("ab", 9223372036854775807)`,
+			&object.Error{Message: "repeat result too long: 9223372036854775807 times 2 bytes"}},
+		{`repeat("", 9223372036854775807)`, ""},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testExpected(t, evaluated, tt.expected)
+	}
+}
+
+func TestConversionBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`type(1) + type("a") + type(if (false) { 1 }) + type(1..2) + type(len)`, "INTEGERSTRINGNULLRANGEBUILTIN"},
+		{`type([]) + type({})`, "ARRAYHASH"},
+		{`type(fn(x) { x })`, "FUNCTION"},
+		{`let f = fn() { 1 }; let g = fn() { f() }; type(g)`, "FUNCTION"},
+		{`fn h() { 1 } type(h)`, "FUNCTION"},
+		{`int("42") + int(" -7 ")`, 35},
+		{`int(true) + int(false) + int(3)`, 4},
+		{`int("4x")`, &object.Error{Message: `cannot convert "4x" to INTEGER`}},
+		{`int("99999999999999999999")`, &object.Error{Message: `"99999999999999999999" is out of range for INTEGER`}},
+		{`int([1])`, &object.Error{Message: "cannot convert ARRAY to INTEGER"}},
+		{`str(42) + str([1, "a"]) + str("s")`, "42[1, a]s"},
+		{`int(str(12)) == 12`, true},
+		{`bool(0)`, true},
+		{`bool(if (false) { 1 })`, false},
+		{`bool(false)`, false},
+		{`str(array(1..4))`, "[1, 2, 3]"},
+		{`array("hé")[1]`, "é"},
+		{`let a = [1]; let b = array(a); a == b`, false},
+		{`array(1)`, &object.Error{Message: "cannot convert INTEGER to ARRAY"}},
+		{`array(0..9223372036854775807)`, &object.Error{Message: "range 0..9223372036854775807 has too many elements for an array: 9223372036854775807"}},
+		{`map(0..9223372036854775807, fn(x) { x })`, &object.Error{Message: "range 0..9223372036854775807 has too many elements for an array: 9223372036854775807"}},
+		{`len([...(0..9223372036854775807)])`, &object.Error{Message: "range 0..9223372036854775807 has too many elements for an array: 9223372036854775807"}},
+		{`len(-5..9223372036854775807)`, 9223372036854775807},
+		{`len(array(9223372036854775806..9223372036854775807))`, 1},
+		{`is_callable(len)`, true},
+		{`is_callable(fn(x) { x })`, true},
+		{`is_callable("len")`, false},
+		{`type()`, &object.Error{Message: "wrong number of arguments. got=0, want=1"}},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testExpected(t, evaluated, tt.expected)
+	}
+}
+
+func TestJSONBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`json_stringify({"b": [1, true, if (false) { 1 }, "x"], "a": {}})`, `{"b":[1,true,null,"x"],"a":{}}`},
+		{`json_stringify([1, [2]], 1)`, "[\n 1,\n [\n  2\n ]\n]"},
+		{`json_stringify({"a": 1}, "--")`, "{\n--\"a\": 1\n}"},
+		{`json_parse(json_stringify({"k": [1, "v", false]}))["k"][1]`, "v"},
+		{`json_parse(json_stringify([1, 2, 3]))[2]`, 3},
+		{`json_parse("[1, 2")`, &object.Error{Message: "invalid JSON at line 1, column 6: unexpected end of JSON input"}},
+		{`json_parse("[1, 2.5]")`, &object.Error{Message: "invalid JSON at line 1, column 5: number 2.5 is not an INTEGER"}},
+		{`json_parse(1)`, &object.Error{Message: "argument to `json_parse` must be STRING, got INTEGER"}},
+		{`json_stringify({1: 2})`, &object.Error{Message: "JSON object keys must be STRING, got INTEGER"}},
+		{`json_stringify(len)`, &object.Error{Message: "cannot encode BUILTIN as JSON"}},
+		{`let a = [1]; a[0] = a; json_stringify(a)`, &object.Error{Message: "cannot encode an ARRAY that contains itself as JSON"}},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testExpected(t, evaluated, tt.expected)
+	}
+}
+
+func TestRegexBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`/(\d+)-(\d+)/.match("a 1-2")`, true},
+		{`regex("^x").match("ax")`, false},
+		{`match(/\d/, "foo1")`, true},
+		{`let f = fn() { /a/ }; f() == f()`, true},
+		{`/a/ == regex("a")`, true},
+		{`/a/ != /b/`, true},
+		{`/a/ == "a"`, false},
+		{`match("foo1", /\d/)`, &object.Error{Message: "argument to `match` must be REGEX, got STRING"}},
+		{`match ("a") { "a" => match(/a/, "a") }`, true},
+		{`/\d+/.find_all("a1 b22 c333")[2]`, "333"},
+		{`len(/z/.find_all("abc"))`, 0},
+		{`/(\d+)-(\d+)/.captures("a 10-20 b")[2]`, "20"},
+		{`/(a)|(b)/.captures("b")[1]`, nil},
+		{`/a/.captures("b")`, nil},
+		{`let c = /(?P<year>\d{4})-(?P<month>\d\d)/.captures("on 2024-05"); c["year"] + c.month`, "202405"},
+		{`/\s*,\s*/.split("a , b,c")[1]`, "b"},
+		{`/(\w+)@(\w+)/.replace_all("x@y and p@q", "$2 at $1")`, "y at x and q at p"},
+		{`/\d+/.replace_all("a1 b22", fn(m) { str(int(m) * 2) })`, "a2 b44"},
+		{`/\d+/.replace_all("a1", fn(m) { 1 })`, &object.Error{Message: "replacement returned to `replace_all` must be STRING, got INTEGER"}},
+		{`type(regex("a/b"))`, "REGEX"},
+		{`let x = 10; let y = 2; x / y / 1`, 5},
+		{`regex("a(")`, &object.Error{Message: "invalid regex /a(/: error parsing regexp: missing closing ): `a(`"}},
+		{`/x/.match(1)`, &object.Error{Message: "argument 2 to `match` must be STRING, got INTEGER"}},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testExpected(t, evaluated, tt.expected)
+	}
+}
+
+func TestFileBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`read_file("data/a.txt")`, "one\ntwo\n"},
+		{`read_lines("data/a.txt")[1]`, "two"},
+		{`write_file("b.txt", "x"); append_file("b.txt", "y"); read_file("b.txt")`, "xy"},
+		{`append_file("new.txt", "z"); read_file("./data/../new.txt")`, "z"},
+		{`list_dir()[0] + list_dir("data")[0]`, "data/a.txt"},
+		{`exists("data/a.txt")`, true},
+		{`exists("data")`, true},
+		{`exists("nope")`, false},
+		{`read_file("nope")`, &object.Error{Message: "cannot read nope: file does not exist"}},
+		{`list_dir("nope")`, &object.Error{Message: "cannot list nope: file does not exist"}},
+		{`write_file("data", "x")`, &object.Error{Message: "cannot write data: is a directory"}},
+		{`read_file("../secret")`, &object.Error{Message: "path ../secret leads outside the sandbox"}},
+		{`read_file("data/../../secret")`, &object.Error{Message: "path data/../../secret leads outside the sandbox"}},
+		{`read_file("/etc/passwd")`, &object.Error{Message: "path /etc/passwd leads outside the sandbox"}},
+		{`write_file("b.txt", 1)`, &object.Error{Message: "argument 2 to `write_file` must be STRING, got INTEGER"}},
+		{`try { read_file("nope") } catch (e) { e.kind }`, "IOError"},
+	}
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		env.SetHost(&object.Host{Files: object.MemFS{"data/a.txt": []byte("one\ntwo\n")}})
+		evaluated := Eval(parser.NewParser(lexer.NewLexer(tt.input)).ParseProgram(), env)
+		testExpected(t, evaluated, tt.expected)
+	}
+
+	disabled := testEval(`read_file("a.txt")`)
+	if err, ok := disabled.(*object.Error); !ok || err.Message != "file access is disabled" {
+		t.Errorf("file access not disabled. got=%s", disabled.Inspect())
+	}
+}
+
+func TestOutputBuiltins(t *testing.T) {
+	tests := []struct {
+		input  string
+		stdout string
+		stderr string
+	}{
+		{`puts(1, "a", [2])`, "1\na\n[2]\n", ""},
+		{`print("a", 1, "b"); print(); print("c")`, "a1bc", ""},
+		{`eprint("oops", 2)`, "", "oops\n2\n"},
+		{`let line = read_line(); print(line + "|" + read_line())`, "first|second", ""},
+		{`read_line(); read_line(); print(type(read_line()))`, "NULL", ""},
+		{`help(substr)`, "substr(s: STRING, start: INTEGER, length?: INTEGER)\n" +
+			"Returns length bytes of s from start on, or the rest of s if there's no length. " +
+			"A negative start counts from the end.\n", ""},
+		{`let g = fn() { puts("in"); yield 1 }; next(g()); puts("out")`, "in\nout\n", ""},
+		{`let h = help; h(print)`, "print(...values)\nPrints values one after the other, with no newline.\n", ""},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		env := object.NewEnvironment()
+		env.SetHost(&object.Host{
+			Stdout: &stdout,
+			Stderr: &stderr,
+			Stdin:  strings.NewReader("first\r\nsecond"),
+		})
+		result := Eval(parser.NewParser(lexer.NewLexer(tt.input)).ParseProgram(), env)
+		if isError(result) {
+			t.Fatalf("eval error: %s", result.Inspect())
+		}
+		if stdout.String() != tt.stdout || stderr.String() != tt.stderr {
+			t.Errorf("wrong output for %q. got=%q and %q, want=%q and %q",
+				tt.input, stdout.String(), stderr.String(), tt.stdout, tt.stderr)
+		}
+	}
+}
+
+func TestExit(t *testing.T) {
+	tests := []struct {
+		input  string
+		code   int
+		stdout string
+	}{
+		{`print(1); exit(3); print(2)`, 3, "1"},
+		{`exit()`, 0, ""},
+		{`try { exit(2) } catch (e) { print("caught") } finally { print("finally") }`, 2, ""},
+		{`try { throw 1 } catch (e) { exit(4) } finally { print("finally") }`, 4, ""},
+		{`let f = fn() { exit(5) }; [1, 2].map(fn(x) { print(x); f() })`, 5, "1"},
+		{`let g = fn() { yield 1; exit(6) }; let it = g(); print(next(it)); next(it)`, 6, "1"},
+	}
+
+	for _, tt := range tests {
+		var stdout bytes.Buffer
+		env := object.NewEnvironment()
+		env.SetHost(&object.Host{Stdout: &stdout})
+		result := Eval(parser.NewParser(lexer.NewLexer(tt.input)).ParseProgram(), env)
+		err, ok := result.(*object.Error)
+		if !ok {
+			t.Errorf("%q did not exit. got=%v", tt.input, result)
+			continue
+		}
+		code, exit := object.ExitCode(err)
+		if !exit || code != tt.code {
+			t.Errorf("%q did not exit with %d. got=%v", tt.input, tt.code, result)
+		}
+		if stdout.String() != tt.stdout {
+			t.Errorf("wrong output for %q. got=%q, want=%q", tt.input, stdout.String(), tt.stdout)
+		}
+	}
+}
+
+func TestHostFunctions(t *testing.T) {
+	newHost := func(greeting string) *object.Host {
+		host := &object.Host{}
+		err := host.Register(&object.Builtin{
+			Name:   "greet",
+			Params: []object.Param{{Name: "name", Types: []object.ObjectType{object.STRING_OBJ}}},
+			Fn: func(ctx object.Context, args ...object.Object) object.Object {
+				return &object.String{Value: greeting + ", " + args[0].(*object.String).Value}
+			},
+		})
+		if err != nil {
+			t.Fatalf("register error: %s", err)
+		}
+		lookup, err := object.WrapFunc("lookup_user", func(id int) (map[string]string, error) {
+			if id != 1 {
+				return nil, fmt.Errorf("no user %d", id)
+			}
+			return map[string]string{"name": "ann"}, nil
+		})
+		if err != nil {
+			t.Fatalf("wrap error: %s", err)
+		}
+		if err := host.Register(lookup); err != nil {
+			t.Fatalf("register error: %s", err)
+		}
+		err = host.Register(&object.Builtin{
+			Name: "crash",
+			Fn: func(ctx object.Context, args ...object.Object) object.Object {
+				panic("crashed")
+			},
+		})
+		if err != nil {
+			t.Fatalf("register error: %s", err)
+		}
+		return host
+	}
+	hello, hi := newHost("hello"), newHost("hi")
+
+	tests := []struct {
+		input    string
+		host     *object.Host
+		expected string
+	}{
+		{`greet("ann")`, hello, "hello, ann"},
+		{`let g = fn() { yield greet("gen") }; next(g())`, hello, "hello, gen"},
+		{`greet("ann")`, hi, "hi, ann"},
+		{`"bob".greet()`, hi, "hi, bob"},
+		{`join(["a", "b"].map(greet), "; ")`, hello, "hello, a; hello, b"},
+		{`let greet = fn(x) { x + "!" }; greet("ann")`, hello, "ann!"},
+		{`greet(1)`, hello, "argument to `greet` must be STRING, got INTEGER"},
+		{`greet()`, hello, "wrong number of arguments. got=0, want=1"},
+		{`greet(lookup_user(1)["name"])`, hi, "hi, ann"},
+		{`lookup_user(2)`, hi, "no user 2"},
+		{`let g = fn() { yield 1; crash() }; let it = g(); next(it); next(it)`, hi, "panic in generator: crashed"},
+		{`let g = fn() { crash(); yield 1 }; try { next(g()) } catch (e) { e.kind }`, hi, "RuntimeError"},
+	}
+
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		env.SetHost(tt.host)
+		result := Eval(parser.NewParser(lexer.NewLexer(tt.input)).ParseProgram(), env)
+		got := result.Inspect()
+		switch result := result.(type) {
+		case *object.String:
+			got = result.Value
+		case *object.Error:
+			got = result.Message
+		}
+		if got != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestBlockScopes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let x = 1; if (true) { let x = 2; x } + x`, 3},
+		{`let x = 1; if (true) { let x = x + 10; x }`, 11},
+		{`let x = 1; if (true) { x = 7 }; x`, 7},
+		{`let f = if (true) { let a = 3; fn() { a } }; let b = 10; f() + b`, 13},
+		{`let f = fn(n) { let t = 0; if (n > 0) { let u = n * 2; t = u }; if (true) { let v = 100; t + v } }; f(4)`, 108},
+		{`let c = 0; let f = fn() { if (true) { let c = 5; c = 6 }; c }; f()`, 0},
+		{`if (true) { let y = 5 }; y`, &object.Error{Message: "identifier not found: y"}},
+		{`match ([1, 2]) { [a, b] => a + b }; a`, &object.Error{Message: "identifier not found: a"}},
+		{`try { throw 1 } catch (e) { e }; e`, &object.Error{Message: "identifier not found: e"}},
+		{
+			`let f = fn() { let z = 1; let g = fn() { if (true) { z = 2 } }; g() }; f()`,
+			&object.Error{Message: "cannot assign to captured variable z"},
+		},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testExpected(t, evaluated, tt.expected)
+	}
+}
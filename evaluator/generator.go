@@ -0,0 +1,124 @@
+package evaluator
+
+import (
+	"runtime"
+
+	"waiacig/ast"
+	"waiacig/object"
+)
+
+// generatorKey names the binding through which the body of a generator
+// function reaches its generator. It can't be written in source.
+const generatorKey = "%generator"
+
+// generator runs the body of a generator function on a goroutine of its
+// own, started by the first call to next. Values are handed back and forth
+// over unbuffered channels, so only one of the body and the caller of next
+// runs at a time.
+//
+// A goroutine waiting at a yield is stopped once the Generator it belongs
+// to is garbage, by a finalizer; its body unwinds without running its
+// finally blocks. A generator its own body can reach, through a variable
+// of an enclosing scope, is never garbage while that goroutine waits, so
+// it's only released by running it to its end.
+type generator struct {
+	body    *ast.BlockStatement
+	env     *object.Environment
+	resume  chan struct{}
+	yields  chan object.Object
+	stop    chan struct{}
+	started bool
+	done    bool
+}
+
+func (g *generator) Type() object.ObjectType { return "GENERATOR_STATE" }
+func (g *generator) Inspect() string         { return "generator state" }
+
+// stopped is what a stopped generator's goroutine panics with to unwind.
+type stopped struct{}
+
+func newGenerator(body *ast.BlockStatement, env *object.Environment) *object.Generator {
+	g := &generator{
+		body:   body,
+		env:    env,
+		resume: make(chan struct{}),
+		yields: make(chan object.Object),
+		stop:   make(chan struct{}),
+	}
+	env.Set(generatorKey, g)
+	gen := &object.Generator{Resume: g.next}
+	runtime.SetFinalizer(gen, func(*object.Generator) { close(g.stop) })
+	return gen
+}
+
+func (g *generator) run() {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		if _, ok := r.(stopped); ok {
+			return
+		}
+		// Nothing could recover a panic on this goroutine, so the caller
+		// of next gets it as an error instead.
+		g.yields <- object.NewError(object.RuntimeError, "panic in generator: %v", r)
+		close(g.yields)
+	}()
+	result := Eval(g.body, g.env)
+	if isError(result) {
+		g.yields <- result
+	}
+	close(g.yields)
+}
+
+// next runs the body up to its next yield, returning the value yielded.
+func (g *generator) next() (object.Object, bool) {
+	if g.done {
+		return nil, false
+	}
+	if g.started {
+		g.resume <- struct{}{}
+	} else {
+		g.started = true
+		go g.run()
+	}
+	value, ok := <-g.yields
+	if !ok || isError(value) {
+		g.done = true
+	}
+	return value, ok
+}
+
+func evalYield(value object.Object, env *object.Environment) object.Object {
+	state, _ := env.Get(generatorKey)
+	g := state.(*generator)
+	g.yields <- value
+	select {
+	case <-g.resume:
+	case <-g.stop:
+		panic(stopped{})
+	}
+	return NULL
+}
+
+// evalYieldDelegate yields each value of an iterator in turn.
+func evalYieldDelegate(value object.Object, env *object.Environment) object.Object {
+	if iterable, ok := value.(object.Iterable); ok {
+		value = iterable.Iter()
+	}
+	iterator, ok := value.(object.Iterator)
+	if !ok {
+		return newError(object.TypeError, "cannot iterate over %s", value.Type())
+	}
+	for {
+		next, ok := iterator.Next()
+		if !ok {
+			return NULL
+		}
+		if isError(next) {
+			return next
+		}
+		evalYield(next, env)
+	}
+}
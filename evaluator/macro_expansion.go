@@ -26,7 +26,7 @@ func DefineMacros(program *ast.Program, env *object.Environment) {
 
 func isMacroDefinition(node ast.Statement) bool {
 	letStatement, ok := node.(*ast.LetStatement)
-	if !ok {
+	if !ok || letStatement.Name == nil {
 		return false
 	}
 
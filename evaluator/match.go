@@ -0,0 +1,126 @@
+package evaluator
+
+import (
+	"waiacig/ast"
+	"waiacig/object"
+)
+
+func evalMatchExpression(
+	node *ast.MatchExpression,
+	env *object.Environment,
+) object.Object {
+	subject := Eval(node.Subject, env)
+	if isError(subject) {
+		return subject
+	}
+	for _, arm := range node.Arms {
+		armEnv := object.NewBlockEnvironment(env)
+		matched, err := matchPattern(arm.Pattern, subject, armEnv)
+		if err != nil {
+			return err
+		}
+		if !matched {
+			continue
+		}
+		if arm.Guard != nil {
+			guard := Eval(arm.Guard, armEnv)
+			if isError(guard) {
+				return guard
+			}
+			if !isTruthy(guard) {
+				continue
+			}
+		}
+		return Eval(arm.Body, armEnv)
+	}
+	return newError(object.MatchError, "no match arm for value: %s", subject.Inspect())
+}
+
+// destructure binds the names in pattern from value, failing with an error
+// when value doesn't fit the pattern.
+func destructure(
+	pattern ast.Pattern,
+	value object.Object,
+	env *object.Environment,
+) *object.Error {
+	matched, err := matchPattern(pattern, value, env)
+	if err != nil {
+		return err
+	}
+	if !matched {
+		return newError(object.MatchError, "cannot destructure %s into %s", value.Inspect(), pattern)
+	}
+	return nil
+}
+
+// matchPattern tests value against pattern, binding the pattern's
+// identifiers in env as it goes.
+func matchPattern(
+	pattern ast.Pattern,
+	value object.Object,
+	env *object.Environment,
+) (bool, *object.Error) {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value != "_" {
+			env.Set(pattern.Value, value)
+		}
+		return true, nil
+	case *ast.IntegerLiteral, *ast.StringLiteral, *ast.Boolean:
+		return matchesValue(value, Eval(pattern, env)), nil
+	case *ast.ArrayPattern:
+		array, ok := value.(*object.Array)
+		if !ok {
+			return false, nil
+		}
+		numElements := len(pattern.Elements)
+		if len(array.Elements) != numElements &&
+			(pattern.Rest == nil || len(array.Elements) < numElements) {
+			return false, nil
+		}
+		for i, el := range pattern.Elements {
+			matched, err := matchPattern(el, array.Elements[i], env)
+			if err != nil || !matched {
+				return matched, err
+			}
+		}
+		if pattern.Rest != nil && pattern.Rest.Value != "_" {
+			rest := make([]object.Object, len(array.Elements)-numElements)
+			copy(rest, array.Elements[numElements:])
+			env.Set(pattern.Rest.Value, &object.Array{Elements: rest})
+		}
+		return true, nil
+	case *ast.HashPattern:
+		hash, ok := value.(*object.Hash)
+		if !ok {
+			return false, nil
+		}
+		for i, keyNode := range pattern.Keys {
+			key, ok := Eval(keyNode, env).(object.Hashable)
+			if !ok {
+				return false, nil
+			}
+			pair, ok := hash.Pairs[key.HashKey()]
+			if !ok {
+				return false, nil
+			}
+			matched, err := matchPattern(pattern.Values[i], pair.Value, env)
+			if err != nil || !matched {
+				return matched, err
+			}
+		}
+		return true, nil
+	}
+	return false, newError(object.RuntimeError, "unknown pattern: %s", pattern)
+}
+
+// matchesValue reports whether value equals the literal pattern, comparing
+// by type and content rather than by identity.
+func matchesValue(value, pattern object.Object) bool {
+	v, ok := value.(object.Hashable)
+	if !ok {
+		return false
+	}
+	p, ok := pattern.(object.Hashable)
+	return ok && v.HashKey() == p.HashKey()
+}
@@ -0,0 +1,41 @@
+package evaluator
+
+import (
+	"waiacig/ast"
+	"waiacig/object"
+)
+
+// boundMethod is what the function of a method call 'obj.name(args)'
+// evaluates to. applyFunction calls the method with the receiver as its
+// first argument.
+type boundMethod struct {
+	method   object.Object
+	receiver object.Object
+}
+
+func (bm *boundMethod) Type() object.ObjectType { return "BOUND_METHOD" }
+func (bm *boundMethod) Inspect() string         { return "bound method" }
+
+// evalMethodExpression looks up the method called by 'obj.name(...)': a
+// hash's own field if it has one, otherwise the builtin with that name. A
+// module's export is called without the module as an argument.
+func evalMethodExpression(node *ast.MethodExpression, env *object.Environment) object.Object {
+	receiver := Eval(node.Object, env)
+	if isError(receiver) {
+		return receiver
+	}
+	name := node.Name.Value
+	if module, ok := receiver.(*object.Module); ok {
+		return module.Member(name)
+	}
+	if hash, ok := receiver.(*object.Hash); ok {
+		key := &object.String{Value: name}
+		if pair, ok := hash.Pairs[key.HashKey()]; ok {
+			return &boundMethod{method: pair.Value, receiver: receiver}
+		}
+	}
+	if builtin := env.Host().Lookup(name); builtin != nil {
+		return &boundMethod{method: builtin, receiver: receiver}
+	}
+	return newError(object.NameError, "undefined method %s for %s", name, receiver.Type())
+}
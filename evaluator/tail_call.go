@@ -0,0 +1,87 @@
+package evaluator
+
+import (
+	"waiacig/ast"
+	"waiacig/object"
+)
+
+// tailCall is returned in place of the result of a call in tail position.
+// applyFunction runs it in its own loop, so recursion through tail calls
+// doesn't grow the Go stack.
+type tailCall struct {
+	fn       object.Object
+	args     []object.Object
+	keywords []keywordArgument
+}
+
+func (tc *tailCall) Type() object.ObjectType { return "TAIL_CALL" }
+func (tc *tailCall) Inspect() string         { return "tail call" }
+
+// evalTailBlock evaluates a block like evalBlockStatement. Calls returned by
+// a return statement, or by the last statement when last is set, are not
+// applied but handed back as a *tailCall.
+func evalTailBlock(
+	block *ast.BlockStatement,
+	env *object.Environment,
+	last bool,
+) object.Object {
+	if err := hoistFunctions(block.Statements, env); err != nil {
+		return err
+	}
+	var result object.Object
+	for i, statement := range block.Statements {
+		isLast := last && i == len(block.Statements)-1
+		switch statement := statement.(type) {
+		case *ast.ReturnStatement:
+			result = evalTailExpression(statement.ReturnValue, env, true)
+			if !isError(result) {
+				result = &object.ReturnValue{Value: result}
+			}
+		case *ast.ExpressionStatement:
+			result = evalTailExpression(statement.Expression, env, isLast)
+		default:
+			result = Eval(statement, env)
+		}
+		if result != nil {
+			rt := result.Type()
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+				return result
+			}
+		}
+	}
+	return result
+}
+
+func evalTailExpression(
+	exp ast.Expression,
+	env *object.Environment,
+	tail bool,
+) object.Object {
+	switch exp := exp.(type) {
+	case *ast.CallExpression:
+		if !tail || exp.Function.TokenLiteral() == "quote" {
+			break
+		}
+		function := Eval(exp.Function, env)
+		if isError(function) {
+			return function
+		}
+		args, keywords, err := evalArguments(exp.Arguments, env)
+		if err != nil {
+			return err
+		}
+		return &tailCall{fn: function, args: args, keywords: keywords}
+	case *ast.IfExpression:
+		condition := Eval(exp.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+		if isTruthy(condition) {
+			return evalTailBlock(exp.Consequence, object.NewBlockEnvironment(env), tail)
+		} else if exp.Alternative != nil {
+			return evalTailBlock(exp.Alternative, object.NewBlockEnvironment(env), tail)
+		}
+		return NULL
+	}
+	return Eval(exp, env)
+}
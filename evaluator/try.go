@@ -0,0 +1,44 @@
+package evaluator
+
+import (
+	"waiacig/ast"
+	"waiacig/object"
+)
+
+// evalTryExpression evaluates the try block, handing any error it raises to
+// the catch block. The finally block runs last whatever happened, short of
+// an exit; its value is discarded unless it raises an error or returns.
+func evalTryExpression(node *ast.TryExpression, env *object.Environment) object.Object {
+	result := Eval(node.Block, env)
+	if isExit(result) {
+		return result
+	}
+	if err, ok := result.(*object.Error); ok && node.Catch != nil {
+		catchEnv := object.NewBlockEnvironment(env)
+		if node.Param != nil {
+			catchEnv.Set(node.Param.Value, err.Caught())
+		}
+		result = Eval(node.Catch, catchEnv)
+		if isExit(result) {
+			return result
+		}
+	}
+	if node.Finally != nil {
+		finally := Eval(node.Finally, env)
+		if finally != nil {
+			ft := finally.Type()
+			if ft == object.RETURN_VALUE_OBJ || ft == object.ERROR_OBJ {
+				return finally
+			}
+		}
+	}
+	if result == nil {
+		return NULL
+	}
+	return result
+}
+
+func isExit(obj object.Object) bool {
+	err, ok := obj.(*object.Error)
+	return ok && err.Kind == object.Exit
+}
@@ -9,6 +9,7 @@ type Lexer struct {
 	position     int
 	readPosition int
 	ch           byte
+	last         token.TokenType // the type of the token read before
 }
 
 func NewLexer(input string) *Lexer {
@@ -28,6 +29,12 @@ func (l *Lexer) readChar() {
 }
 
 func (l *Lexer) NextToken() token.Token {
+	tok := l.nextToken()
+	l.last = tok.Type
+	return tok
+}
+
+func (l *Lexer) nextToken() token.Token {
 	var tok token.Token
 	l.skipWhitespace()
 	switch l.ch {
@@ -35,6 +42,9 @@ func (l *Lexer) NextToken() token.Token {
 		if l.peekChar() == '=' {
 			l.readChar()
 			tok = newToken(token.EQ, "==")
+		} else if l.peekChar() == '>' {
+			l.readChar()
+			tok = newToken(token.ARROW, "=>")
 		} else {
 			tok = l.newToken(token.ASSIGN)
 		}
@@ -50,11 +60,23 @@ func (l *Lexer) NextToken() token.Token {
 	case '*':
 		tok = l.newToken(token.ASTERISK)
 	case '/':
-		tok = l.newToken(token.SLASH)
+		if l.startsRegex() {
+			tok.Type = token.REGEX
+			tok.Literal = l.readRegex()
+		} else {
+			tok = l.newToken(token.SLASH)
+		}
 	case '<':
 		tok = l.newToken(token.LT)
 	case '>':
 		tok = l.newToken(token.GT)
+	case '|':
+		if l.peekChar() == '>' {
+			l.readChar()
+			tok = newToken(token.PIPELINE, "|>")
+		} else {
+			tok = l.newToken(token.PIPE)
+		}
 
 	case ';':
 		tok = l.newToken(token.SEMICOLON)
@@ -82,6 +104,17 @@ func (l *Lexer) NextToken() token.Token {
 		tok.Type = token.EOF
 	case ':':
 		tok = l.newToken(token.COLON)
+	case '.':
+		if l.peekChar() == '.' && l.peekCharAt(1) == '.' {
+			l.readChar()
+			l.readChar()
+			tok = newToken(token.ELLIPSIS, "...")
+		} else if l.peekChar() == '.' {
+			l.readChar()
+			tok = newToken(token.RANGE, "..")
+		} else {
+			tok = l.newToken(token.DOT)
+		}
 	default:
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
@@ -107,6 +140,13 @@ func (l *Lexer) peekChar() byte {
 	}
 }
 
+func (l *Lexer) peekCharAt(offset int) byte {
+	if l.readPosition+offset >= len(l.input) {
+		return 0
+	}
+	return l.input[l.readPosition+offset]
+}
+
 func (l *Lexer) readIdentifier() string {
 	position := l.position
 	for isLetter(l.ch) {
@@ -148,6 +188,46 @@ func (l *Lexer) readString() string {
 	return l.input[position:l.position]
 }
 
+// startsRegex reports whether the slash at the current position starts a
+// regex literal rather than dividing. It does where an operand can start,
+// that is not after a token that ends one, if the literal ends on the same
+// line.
+func (l *Lexer) startsRegex() bool {
+	switch l.last {
+	case token.IDENT, token.INT, token.STRING, token.REGEX, token.TRUE, token.FALSE,
+		token.RPAREN, token.RBRACKET, token.RBRACE:
+		return false
+	}
+	return regexEnd(l.input, l.position) >= 0
+}
+
+// readRegex reads a regex literal. A slash in the pattern is escaped with a
+// backslash, which is left in: the regexp package takes \/ for a slash.
+func (l *Lexer) readRegex() string {
+	end := regexEnd(l.input, l.position)
+	pattern := l.input[l.position+1 : end]
+	for l.position < end {
+		l.readChar()
+	}
+	return pattern
+}
+
+// regexEnd returns the position of the slash closing the regex literal
+// that starts at start, or -1 if the line ends first.
+func regexEnd(input string, start int) int {
+	for i := start + 1; i < len(input); i++ {
+		switch input[i] {
+		case '\\':
+			i++
+		case '\n':
+			return -1
+		case '/':
+			return i
+		}
+	}
+	return -1
+}
+
 func (l *Lexer) newToken(tokenType token.TokenType) token.Token {
 	return token.Token{Type: tokenType, Literal: string(l.ch)}
 }
@@ -1,6 +1,7 @@
 package lexer
 
 import (
+	"strings"
 	"testing"
 
 	"waiacig/token"
@@ -31,6 +32,10 @@ if (5 < 10) {
 [1, 2];
 {"foo": "bar"}
 macro(x, y) { x + y; };
+match (x) { [a, ...b] => a }
+x |> |y| y
+a.b
+0..n
 `
 
 	tests := []struct {
@@ -136,6 +141,32 @@ macro(x, y) { x + y; };
 		{token.SEMICOLON, ";"},
 		{token.RBRACE, "}"},
 		{token.SEMICOLON, ";"},
+		{token.MATCH, "match"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.LBRACKET, "["},
+		{token.IDENT, "a"},
+		{token.COMMA, ","},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "b"},
+		{token.RBRACKET, "]"},
+		{token.ARROW, "=>"},
+		{token.IDENT, "a"},
+		{token.RBRACE, "}"},
+		{token.IDENT, "x"},
+		{token.PIPELINE, "|>"},
+		{token.PIPE, "|"},
+		{token.IDENT, "y"},
+		{token.PIPE, "|"},
+		{token.IDENT, "y"},
+		{token.IDENT, "a"},
+		{token.DOT, "."},
+		{token.IDENT, "b"},
+		{token.INT, "0"},
+		{token.RANGE, ".."},
+		{token.IDENT, "n"},
 		{token.EOF, ""},
 	}
 
@@ -155,3 +186,27 @@ macro(x, y) { x + y; };
 		}
 	}
 }
+
+func TestRegexLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // the type and literal of each token
+	}{
+		{`/a\/b/.x`, `REGEX a\/b|. .|IDENT x`},
+		{`f(/x/, /y/)`, `IDENT f|( (|REGEX x|, ,|REGEX y|) )`},
+		{`a / b / c`, `IDENT a|/ /|IDENT b|/ /|IDENT c`},
+		{`(1) / 2 /`, `( (|INT 1|) )|/ /|INT 2|/ /`},
+		{"!/2\n/", `! !|/ /|INT 2|/ /`},
+	}
+
+	for _, tt := range tests {
+		l := NewLexer(tt.input)
+		tokens := []string{}
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+			tokens = append(tokens, string(tok.Type)+" "+tok.Literal)
+		}
+		if got := strings.Join(tokens, "|"); got != tt.expected {
+			t.Errorf("wrong tokens for %q. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
@@ -15,5 +15,5 @@ func main() {
 	}
 	fmt.Printf("Hello %s! This is the waiacig repl\n", u.Username)
 	fmt.Printf("Feel free to type in commands\n")
-	repl.StartREPL(os.Stdin, os.Stdout)
+	os.Exit(repl.StartREPL(os.Stdin, os.Stdout))
 }
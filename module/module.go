@@ -0,0 +1,159 @@
+package module
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"waiacig/ast"
+	"waiacig/evaluator"
+	"waiacig/lexer"
+	"waiacig/object"
+	"waiacig/parser"
+)
+
+// Loader finds, parses and macro-expands the files of imported modules.
+// It keeps track of the imports being loaded, so that an import cycle is
+// reported rather than followed forever.
+//
+// Module files are read from disk, on the search paths, whatever the Files
+// of Host: the paths are chosen by whoever runs the program, not by the
+// program itself, so the sandbox of the file builtins doesn't cover them.
+type Loader struct {
+	// Paths are the directories searched for a module, in order, after the
+	// directory of the module that imports it.
+	Paths []string
+	// Host is set as the host of the environments modules are evaluated in.
+	Host *object.Host
+
+	loading []entry
+	modules map[string]*object.Module // evaluated modules, by file
+}
+
+type entry struct {
+	path string // as written in the import
+	file string
+}
+
+// NewLoader returns a Loader searching paths, or the current directory if
+// none are given.
+func NewLoader(paths ...string) *Loader {
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	return &Loader{Paths: paths, modules: map[string]*object.Module{}}
+}
+
+// Exported reports whether a module's top-level binding called name is
+// visible to importers. Names starting with an underscore are private.
+func Exported(name string) bool {
+	if name == "" {
+		return false
+	}
+	c := name[0]
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// Resolve returns the file an import of path refers to. A relative path is
+// looked up next to the module being loaded, then on the search paths.
+func (l *Loader) Resolve(path string) (string, error) {
+	if filepath.IsAbs(path) {
+		if isFile(path) {
+			return filepath.Clean(path), nil
+		}
+		return "", fmt.Errorf("module not found: %s", path)
+	}
+	dirs := l.Paths
+	if n := len(l.loading); n > 0 {
+		dirs = append([]string{filepath.Dir(l.loading[n-1].file)}, dirs...)
+	}
+	for _, dir := range dirs {
+		file := filepath.Join(dir, path)
+		if isFile(file) {
+			abs, err := filepath.Abs(file)
+			if err != nil {
+				return "", err
+			}
+			return abs, nil
+		}
+	}
+	return "", fmt.Errorf("module not found: %s", path)
+}
+
+func isFile(file string) bool {
+	info, err := os.Stat(file)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// Enter starts loading the module imported as path from file, returning
+// its macro-expanded program. Every successful Enter must be matched by a
+// call to Leave once the module is loaded.
+func (l *Loader) Enter(path, file string) (*ast.Program, error) {
+	for i, e := range l.loading {
+		if e.file != file {
+			continue
+		}
+		chain := []string{}
+		for _, e := range l.loading[i:] {
+			chain = append(chain, e.path)
+		}
+		chain = append(chain, path)
+		return nil, fmt.Errorf("import cycle: %s", strings.Join(chain, " -> "))
+	}
+	source, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	p := parser.NewParser(lexer.NewLexer(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("%s: %s", path, strings.Join(p.Errors(), "; "))
+	}
+	macroEnv := object.NewEnvironment()
+	evaluator.DefineMacros(program, macroEnv)
+	expanded, ok := evaluator.ExpandMacros(program, macroEnv).(*ast.Program)
+	if !ok {
+		return nil, fmt.Errorf("%s: macro expansion failed", path)
+	}
+	l.loading = append(l.loading, entry{path: path, file: file})
+	return expanded, nil
+}
+
+// Leave finishes loading the module most recently entered.
+func (l *Loader) Leave() {
+	l.loading = l.loading[:len(l.loading)-1]
+}
+
+// Import implements object.Importer for the evaluator. Each module is
+// evaluated once, in an environment of its own.
+func (l *Loader) Import(path string) object.Object {
+	file, err := l.Resolve(path)
+	if err != nil {
+		return object.NewError(object.ImportError, "%s", err)
+	}
+	if module, ok := l.modules[file]; ok {
+		return module
+	}
+	program, err := l.Enter(path, file)
+	if err != nil {
+		return object.NewError(object.ImportError, "%s", err)
+	}
+	defer l.Leave()
+
+	env := object.NewEnvironment()
+	env.SetImporter(l)
+	env.SetHost(l.Host)
+	result := evaluator.Eval(program, env)
+	if err, ok := result.(*object.Error); ok {
+		return err
+	}
+	module := &object.Module{Name: path, Exports: map[string]object.Object{}}
+	for _, name := range env.Names() {
+		if Exported(name) {
+			module.Exports[name], _ = env.Get(name)
+		}
+	}
+	l.modules[file] = module
+	return module
+}
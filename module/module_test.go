@@ -0,0 +1,197 @@
+package module_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"waiacig/compiler"
+	"waiacig/evaluator"
+	"waiacig/lexer"
+	"waiacig/module"
+	"waiacig/object"
+	"waiacig/parser"
+	"waiacig/vm"
+)
+
+var files = map[string]string{
+	"lib/math.mk": `let square = fn(x) { x * x };
+		let pi = 3;
+		let _secret = 42;
+		let x = 10;`,
+	"lib/wrap.mk": `import "math.mk" as m;
+		let quad = fn(x) { m.square(m.square(x)) };`,
+	"macros.mk": `let unless = macro(c, a, b) {
+			quote(if (!(unquote(c))) { unquote(a) } else { unquote(b) })
+		};
+		let v = unless(false, 1, 2);`,
+	"left.mk":   `import "shared.mk" as shared;`,
+	"right.mk":  `import "shared.mk" as shared;`,
+	"shared.mk": `let value = 1;`,
+	"a.mk":      `import "b.mk" as b;`,
+	"b.mk":      `import "c.mk" as c;`,
+	"c.mk":      `import "a.mk" as a;`,
+	"fails.mk":  `let value = 1; throw "broken";`,
+	"loud.mk":   `puts("loaded"); let value = 1;`,
+}
+
+func writeFiles(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "modules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, source := range files {
+		file := filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(file), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(file, []byte(source), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// run evaluates input with the evaluator and the VM, returning the result
+// of each, or the message of the error it failed with.
+func run(input string, paths ...string) (string, string) {
+	p := parser.NewParser(lexer.NewLexer(input))
+	program := p.ParseProgram()
+
+	env := object.NewEnvironment()
+	env.SetImporter(module.NewLoader(paths...))
+	evaluated := evaluator.Eval(program, env)
+	evalResult := evaluated.Inspect()
+	if err, ok := evaluated.(*object.Error); ok {
+		evalResult = err.Message
+	}
+
+	comp := compiler.NewCompiler()
+	comp.SetModuleLoader(module.NewLoader(paths...))
+	err := comp.Compile(program)
+	if err != nil {
+		return evalResult, err.Error()
+	}
+	machine := vm.NewVM(comp.Bytecode())
+	err = machine.Run()
+	if err != nil {
+		return evalResult, err.Error()
+	}
+	return evalResult, machine.LastPoppedStackElem().Inspect()
+}
+
+func TestImports(t *testing.T) {
+	dir := writeFiles(t)
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import "lib/math.mk" as m; m.square(4)`, "16"},
+		{`let m = import("lib/math.mk"); m["pi"]`, "3"},
+		{`import "lib/math.mk" as m; m.square(m.pi)`, "9"},
+		{`let x = 1; import "lib/math.mk" as m; x + m.x`, "11"},
+		{`import "lib/wrap.mk" as w; w.quad(2)`, "16"},
+		{`import "macros.mk" as m; m.v`, "1"},
+		{`import("shared.mk") == import("shared.mk")`, "true"},
+		{`import "left.mk" as l; import "right.mk" as r; l.shared == r.shared`, "true"},
+		{`import "lib/math.mk" as m; m._secret`, `module "lib/math.mk" has no export _secret`},
+		{`import "lib/math.mk" as m; m.cube(2)`, `module "lib/math.mk" has no export cube`},
+		{`import "a.mk" as a; 1`, "import cycle: a.mk -> b.mk -> c.mk -> a.mk"},
+		{`import "missing.mk" as m; 1`, "module not found: missing.mk"},
+		{`try { import("fails.mk") } catch (e) { e }`, "broken"},
+	}
+	for _, tt := range tests {
+		evalResult, vmResult := run(tt.input, dir)
+		if evalResult != tt.expected {
+			t.Errorf("evaluator: %s\nwant=%q, got=%q", tt.input, tt.expected, evalResult)
+		}
+		if vmResult != tt.expected {
+			t.Errorf("vm: %s\nwant=%q, got=%q", tt.input, tt.expected, vmResult)
+		}
+	}
+}
+
+func TestSearchPaths(t *testing.T) {
+	dir := writeFiles(t)
+	defer os.RemoveAll(dir)
+
+	evalResult, vmResult := run(`import "math.mk" as m; m.square(3)`, dir, filepath.Join(dir, "lib"))
+	if evalResult != "9" || vmResult != "9" {
+		t.Errorf("wrong results. evaluator=%q, vm=%q", evalResult, vmResult)
+	}
+
+	file := filepath.Join(dir, "lib", "math.mk")
+	evalResult, vmResult = run(`import "`+file+`" as m; m.pi`, filepath.Join(dir, "nowhere"))
+	if evalResult != "3" || vmResult != "3" {
+		t.Errorf("wrong results for absolute path. evaluator=%q, vm=%q", evalResult, vmResult)
+	}
+}
+
+func TestCompileErrorInModule(t *testing.T) {
+	dir := writeFiles(t)
+	defer os.RemoveAll(dir)
+	err := ioutil.WriteFile(filepath.Join(dir, "bad.mk"), []byte("let y = zzz;"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	evalResult, vmResult := run(`import "bad.mk" as b; 1`, dir)
+	if evalResult != "identifier not found: zzz" {
+		t.Errorf("wrong evaluator error. got=%q", evalResult)
+	}
+	if vmResult != "bad.mk: undefined variable zzz" {
+		t.Errorf("wrong compiler error. got=%q", vmResult)
+	}
+}
+
+// TestModulesAcrossLines runs lines one after the other the way the REPL
+// does, checking that a module imported by several of them runs once.
+func TestModulesAcrossLines(t *testing.T) {
+	dir := writeFiles(t)
+	defer os.RemoveAll(dir)
+
+	var out bytes.Buffer
+	host := &object.Host{Stdout: &out}
+	symbolTable := compiler.NewSymbolTable()
+	constants := []object.Object{}
+	globals := make([]object.Object, vm.GlobalsSize)
+	compiled := compiler.NewModules(module.NewLoader(dir))
+	imported := vm.Modules{}
+
+	lines := []string{
+		`import "loud.mk" as a;`,
+		`import "loud.mk" as b; nope`,
+		`import "loud.mk" as c;`,
+		`a.value + c.value`,
+	}
+	var result object.Object
+	for _, line := range lines {
+		comp := compiler.NewCompilerWithState(symbolTable, constants)
+		comp.SetModules(compiled)
+		comp.SetHost(host)
+		err := comp.Compile(parser.NewParser(lexer.NewLexer(line)).ParseProgram())
+		constants = comp.Bytecode().Constants
+		if err != nil {
+			continue
+		}
+		machine := vm.NewWithGlobalsStore(comp.Bytecode(), globals)
+		machine.SetHost(host)
+		machine.SetModules(imported)
+		if err := machine.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		result = machine.LastPoppedStackElem()
+	}
+	if out.String() != "loaded\n" {
+		t.Errorf("wrong output. want=%q, got=%q", "loaded\n", out.String())
+	}
+	if result.Inspect() != "2" {
+		t.Errorf("wrong result. want=2, got=%s", result.Inspect())
+	}
+}
@@ -2,71 +2,53 @@ package object
 
 import (
 	"fmt"
-	"os"
+	"strings"
 )
 
-var Builtins = []struct {
-	Name    string
-	Builtin *Builtin
-}{
-	{
-		"len",
-		&Builtin{Fn: func(args ...Object) Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1",
-					len(args))
-			}
+// Builtins are the builtins of both engines. The compiler refers to them by
+// their index in the list, so new ones go at the end.
+var Builtins = []*Builtin{
+	{
+		Name:   "len",
+		Params: []Param{param("value", ARRAY_OBJ, STRING_OBJ, RANGE_OBJ, HASH_OBJ)},
+		Doc:    "Returns the number of elements of an array, range or hash, or of bytes in a string.",
+		Fn: func(ctx Context, args ...Object) Object {
 			switch arg := args[0].(type) {
 			case *Array:
 				return &Integer{Value: int64(len(arg.Elements))}
 			case *String:
 				return &Integer{Value: int64(len(arg.Value))}
+			case *Range:
+				return &Integer{Value: arg.Len()}
 			default:
-				return newError("argument to `len` not supported, got %s", args[0].Type())
+				return &Integer{Value: int64(len(arg.(*Hash).Keys))}
 			}
 		},
-		},
 	},
 	{
-		"puts",
-		&Builtin{Fn: func(args ...Object) Object {
-			for _, arg := range args {
-				fmt.Println(arg.Inspect())
-			}
-			return nil
-		},
-		},
+		Name:     "puts",
+		Params:   []Param{param("values")},
+		Variadic: true,
+		Doc:      "Prints each value on a line of its own.",
+		Fn:       builtinPuts,
 	},
 	{
-		"first",
-		&Builtin{Fn: func(args ...Object) Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1",
-					len(args))
-			}
-			if args[0].Type() != ARRAY_OBJ {
-				return newError("argument to `first` must be ARRAY, got %s",
-					args[0].Type())
-			}
+		Name:   "first",
+		Params: []Param{param("array", ARRAY_OBJ)},
+		Doc:    "Returns the first element of an array, or null if it's empty.",
+		Fn: func(ctx Context, args ...Object) Object {
 			arr := args[0].(*Array)
 			if len(arr.Elements) > 0 {
 				return arr.Elements[0]
 			}
 			return nil
 		},
-		},
 	},
 	{
-		"last",
-		&Builtin{Fn: func(args ...Object) Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1",
-					len(args))
-			}
-			if args[0].Type() != ARRAY_OBJ {
-				return newError("argument to `last` must be ARRAY, got %s",
-					args[0].Type())
-			}
+		Name:   "last",
+		Params: []Param{param("array", ARRAY_OBJ)},
+		Doc:    "Returns the last element of an array, or null if it's empty.",
+		Fn: func(ctx Context, args ...Object) Object {
 			arr := args[0].(*Array)
 			length := len(arr.Elements)
 			if length > 0 {
@@ -74,19 +56,12 @@ var Builtins = []struct {
 			}
 			return nil
 		},
-		},
 	},
 	{
-		"rest",
-		&Builtin{Fn: func(args ...Object) Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1",
-					len(args))
-			}
-			if args[0].Type() != ARRAY_OBJ {
-				return newError("argument to `rest` must be ARRAY, got %s",
-					args[0].Type())
-			}
+		Name:   "rest",
+		Params: []Param{param("array", ARRAY_OBJ)},
+		Doc:    "Returns a new array of all the elements but the first, or null if there are none.",
+		Fn: func(ctx Context, args ...Object) Object {
 			arr := args[0].(*Array)
 			length := len(arr.Elements)
 			if length > 0 {
@@ -96,19 +71,12 @@ var Builtins = []struct {
 			}
 			return nil
 		},
-		},
 	},
 	{
-		"push",
-		&Builtin{Fn: func(args ...Object) Object {
-			if len(args) != 2 {
-				return newError("wrong number of arguments. got=%d, want=2",
-					len(args))
-			}
-			if args[0].Type() != ARRAY_OBJ {
-				return newError("argument to `push` must be ARRAY, got %s",
-					args[0].Type())
-			}
+		Name:   "push",
+		Params: []Param{param("array", ARRAY_OBJ), param("value")},
+		Doc:    "Returns a new array of the elements followed by value.",
+		Fn: func(ctx Context, args ...Object) Object {
 			arr := args[0].(*Array)
 			length := len(arr.Elements)
 			newElements := make([]Object, length+1, length+1)
@@ -116,27 +84,394 @@ var Builtins = []struct {
 			newElements[length] = args[1]
 			return &Array{Elements: newElements}
 		},
+	},
+	{
+		Name:     "exit",
+		Params:   []Param{param("code", INTEGER_OBJ)},
+		Optional: 1,
+		Doc:      "Stops the script with an exit code, 0 by default. No catch or finally block runs.",
+		Fn: func(ctx Context, args ...Object) Object {
+			code := int64(0)
+			if len(args) == 1 {
+				code = args[0].(*Integer).Value
+			}
+			return &Error{Kind: Exit, Message: fmt.Sprintf("exit %d", code), Code: int(code)}
 		},
 	},
 	{
-		"exit",
-		&Builtin{Fn: func(args ...Object) Object {
-			os.Exit(0)
-			return nil
+		Name:   "next",
+		Params: []Param{param("iterator", ITERATOR)},
+		Doc:    "Returns the next value of an iterator, or null when it's done.",
+		Fn: func(ctx Context, args ...Object) Object {
+			value, ok := args[0].(Iterator).Next()
+			if !ok {
+				return nil
+			}
+			return value
 		},
+	},
+	{
+		Name:   "freeze",
+		Params: []Param{param("value")},
+		Doc:    "Makes an array or hash, and those inside it, immutable, and returns it.",
+		Fn: func(ctx Context, args ...Object) Object {
+			freeze(args[0])
+			return args[0]
 		},
 	},
+	{
+		Name:   "map",
+		Params: []Param{param("collection", ITERABLE), param("fn")},
+		Doc:    "Returns an array of what fn returns for each element.",
+		Fn:     builtinMap,
+	},
+	{
+		Name:   "filter",
+		Params: []Param{param("collection", ITERABLE), param("fn")},
+		Doc:    "Returns an array of the elements for which fn returns a truthy value.",
+		Fn:     builtinFilter,
+	},
+	{
+		Name:     "reduce",
+		Params:   []Param{param("collection", ITERABLE), param("fn"), param("initial")},
+		Optional: 1,
+		Doc: "Folds the elements into an accumulator with fn(acc, element), starting from " +
+			"initial, or from the first element if there's no initial value.",
+		Fn: builtinReduce,
+	},
+	{
+		Name:   "each",
+		Params: []Param{param("collection", ITERABLE), param("fn")},
+		Doc:    "Calls fn with each element, and returns null.",
+		Fn:     builtinEach,
+	},
+	{
+		Name:   "any",
+		Params: []Param{param("collection", ITERABLE), param("fn")},
+		Doc:    "Reports whether fn returns a truthy value for any element.",
+		Fn:     builtinAny,
+	},
+	{
+		Name:   "all",
+		Params: []Param{param("collection", ITERABLE), param("fn")},
+		Doc:    "Reports whether fn returns a truthy value for every element.",
+		Fn:     builtinAll,
+	},
+	{
+		Name:   "find",
+		Params: []Param{param("collection", ITERABLE), param("fn")},
+		Doc:    "Returns the first element for which fn returns a truthy value, or null.",
+		Fn:     builtinFind,
+	},
+	{
+		Name:   "sort_by",
+		Params: []Param{param("collection", ITERABLE), param("fn")},
+		Doc: "Returns an array of the elements sorted by the key fn returns for each. " +
+			"The sort is stable, and the keys must be all integers or all strings.",
+		Fn: builtinSortBy,
+	},
+	{
+		Name:   "keys",
+		Params: []Param{param("hash", HASH_OBJ)},
+		Doc:    "Returns an array of the keys of a hash, in insertion order.",
+		Fn:     builtinKeys,
+	},
+	{
+		Name:   "values",
+		Params: []Param{param("hash", HASH_OBJ)},
+		Doc:    "Returns an array of the values of a hash, in insertion order.",
+		Fn:     builtinValues,
+	},
+	{
+		Name:   "items",
+		Params: []Param{param("hash", HASH_OBJ)},
+		Doc:    "Returns an array of the [key, value] pairs of a hash, in insertion order.",
+		Fn:     builtinItems,
+	},
+	{
+		Name:   "has",
+		Params: []Param{param("hash", HASH_OBJ), param("key")},
+		Doc:    "Reports whether a hash has a key.",
+		Fn:     builtinHas,
+	},
+	{
+		Name:   "delete",
+		Params: []Param{param("hash", HASH_OBJ), param("key")},
+		Doc:    "Returns a copy of a hash without key.",
+		Fn:     builtinDelete,
+	},
+	{
+		Name:   "merge",
+		Params: []Param{param("hash", HASH_OBJ), param("other", HASH_OBJ)},
+		Doc:    "Returns a hash of the pairs of hash and then other, whose values win for keys in both.",
+		Fn:     builtinMerge,
+	},
+	{
+		Name:   "split",
+		Params: []Param{param("s", STRING_OBJ, REGEX_OBJ), param("sep", STRING_OBJ)},
+		Doc: "Returns an array of the parts of s between the occurrences of sep. " +
+			"Called as a regex's method, it splits the string around the regex's matches.",
+		Fn: builtinSplit,
+	},
+	{
+		Name:   "join",
+		Params: []Param{param("array", ARRAY_OBJ), param("sep", STRING_OBJ)},
+		Doc:    "Returns the strings of an array joined by sep.",
+		Fn:     builtinJoin,
+	},
+	{
+		Name:   "trim",
+		Params: []Param{param("s", STRING_OBJ)},
+		Doc:    "Returns s without leading and trailing white space.",
+		Fn:     stringBuiltin(strings.TrimSpace),
+	},
+	{
+		Name:   "trim_left",
+		Params: []Param{param("s", STRING_OBJ)},
+		Doc:    "Returns s without leading white space.",
+		Fn:     stringBuiltin(trimLeft),
+	},
+	{
+		Name:   "trim_right",
+		Params: []Param{param("s", STRING_OBJ)},
+		Doc:    "Returns s without trailing white space.",
+		Fn:     stringBuiltin(trimRight),
+	},
+	{
+		Name:   "replace",
+		Params: []Param{param("s", STRING_OBJ), param("old", STRING_OBJ), param("new", STRING_OBJ)},
+		Doc:    "Returns s with every occurrence of old replaced by new.",
+		Fn:     builtinReplace,
+	},
+	{
+		Name:   "contains",
+		Params: []Param{param("s", STRING_OBJ), param("substr", STRING_OBJ)},
+		Doc:    "Reports whether substr is in s.",
+		Fn:     stringTest(strings.Contains),
+	},
+	{
+		Name:   "starts_with",
+		Params: []Param{param("s", STRING_OBJ), param("prefix", STRING_OBJ)},
+		Doc:    "Reports whether s begins with prefix.",
+		Fn:     stringTest(strings.HasPrefix),
+	},
+	{
+		Name:   "ends_with",
+		Params: []Param{param("s", STRING_OBJ), param("suffix", STRING_OBJ)},
+		Doc:    "Reports whether s ends with suffix.",
+		Fn:     stringTest(strings.HasSuffix),
+	},
+	{
+		Name:   "index_of",
+		Params: []Param{param("s", STRING_OBJ), param("substr", STRING_OBJ)},
+		Doc:    "Returns the byte position of the first substr in s, or -1 if there's none.",
+		Fn:     builtinIndexOf,
+	},
+	{
+		Name:   "upper",
+		Params: []Param{param("s", STRING_OBJ)},
+		Doc:    "Returns s in upper case.",
+		Fn:     stringBuiltin(strings.ToUpper),
+	},
+	{
+		Name:   "lower",
+		Params: []Param{param("s", STRING_OBJ)},
+		Doc:    "Returns s in lower case.",
+		Fn:     stringBuiltin(strings.ToLower),
+	},
+	{
+		Name:   "repeat",
+		Params: []Param{param("s", STRING_OBJ), param("count", INTEGER_OBJ)},
+		Doc:    "Returns count copies of s one after the other.",
+		Fn:     builtinRepeat,
+	},
+	{
+		Name:     "substr",
+		Params:   []Param{param("s", STRING_OBJ), param("start", INTEGER_OBJ), param("length", INTEGER_OBJ)},
+		Optional: 1,
+		Doc: "Returns length bytes of s from start on, or the rest of s if there's no length. " +
+			"A negative start counts from the end.",
+		Fn: builtinSubstr,
+	},
+	{
+		Name:   "chars",
+		Params: []Param{param("s", STRING_OBJ)},
+		Doc:    "Returns an array of the characters of s.",
+		Fn:     builtinChars,
+	},
+	{
+		Name:     "format",
+		Params:   []Param{param("format", STRING_OBJ), param("values")},
+		Variadic: true,
+		Doc: "Formats values with the verbs of Go's fmt: %v and %s for any value, %q for a " +
+			"quoted one, %d, %b, %o, %x, %X and %c for integers, %t for booleans and %% for a percent sign.",
+		Fn: builtinFormat,
+	},
+	{
+		Name:   "type",
+		Params: []Param{param("value")},
+		Doc:    "Returns the name of the type of value.",
+		Fn:     builtinType,
+	},
+	{
+		Name:   "int",
+		Params: []Param{param("value")},
+		Doc:    "Converts an integer, a string of decimal digits or a boolean to an integer.",
+		Fn:     builtinInt,
+	},
+	{
+		Name:   "str",
+		Params: []Param{param("value")},
+		Doc:    "Converts value to a string, the way puts prints it.",
+		Fn:     builtinStr,
+	},
+	{
+		Name:   "bool",
+		Params: []Param{param("value")},
+		Doc:    "Reports whether value is truthy.",
+		Fn:     builtinBool,
+	},
+	{
+		Name:   "array",
+		Params: []Param{param("value")},
+		Doc:    "Converts a string to an array of its characters and a range to an array of its elements, or copies an array.",
+		Fn:     builtinArray,
+	},
+	{
+		Name:   "is_callable",
+		Params: []Param{param("value")},
+		Doc:    "Reports whether value is a function.",
+		Fn:     builtinIsCallable,
+	},
+	{
+		Name:   "json_parse",
+		Params: []Param{param("json", STRING_OBJ)},
+		Doc:    "Parses JSON into hashes, arrays, strings, integers, booleans and null.",
+		Fn:     builtinJSONParse,
+	},
+	{
+		Name:     "json_stringify",
+		Params:   []Param{param("value"), param("indent", INTEGER_OBJ, STRING_OBJ)},
+		Optional: 1,
+		Doc: "Encodes value as JSON, on several lines indented by indent, a number of spaces " +
+			"or a string, if there is one.",
+		Fn: builtinJSONStringify,
+	},
+	{
+		Name:   "regex",
+		Params: []Param{param("pattern", STRING_OBJ)},
+		Doc:    "Compiles a regular expression in the syntax of Go's regexp package.",
+		Fn:     builtinRegex,
+	},
+	{
+		Name:   "match",
+		Params: []Param{param("regex", REGEX_OBJ), param("s", STRING_OBJ)},
+		Doc:    "Reports whether regex matches s. It's called as the regex's method.",
+		Fn:     builtinMatch,
+	},
+	{
+		Name:   "find_all",
+		Params: []Param{param("regex", REGEX_OBJ), param("s", STRING_OBJ)},
+		Doc:    "Returns an array of the matches of regex in s.",
+		Fn:     builtinFindAll,
+	},
+	{
+		Name:   "captures",
+		Params: []Param{param("regex", REGEX_OBJ), param("s", STRING_OBJ)},
+		Doc: "Returns the groups of the first match of regex in s, or null: a hash of the " +
+			"named groups if there are any, or else an array of the match and each group.",
+		Fn: builtinCaptures,
+	},
+	{
+		Name:   "replace_all",
+		Params: []Param{param("regex", REGEX_OBJ), param("s", STRING_OBJ), param("replacement")},
+		Doc: "Replaces the matches of regex in s by a string, in which $1 or ${name} stands " +
+			"for a group, or by what a function returns given the match.",
+		Fn: builtinReplaceAll,
+	},
+	{
+		Name:   "read_file",
+		Params: []Param{param("path", STRING_OBJ)},
+		Doc:    "Returns the contents of a file.",
+		Fn:     builtinReadFile,
+	},
+	{
+		Name:   "read_lines",
+		Params: []Param{param("path", STRING_OBJ)},
+		Doc:    "Returns an array of the lines of a file, without their line endings.",
+		Fn:     builtinReadLines,
+	},
+	{
+		Name:   "write_file",
+		Params: []Param{param("path", STRING_OBJ), param("contents", STRING_OBJ)},
+		Doc:    "Writes a file, replacing what it held.",
+		Fn:     builtinWriteFile,
+	},
+	{
+		Name:   "append_file",
+		Params: []Param{param("path", STRING_OBJ), param("contents", STRING_OBJ)},
+		Doc:    "Adds to the end of a file, making it if it doesn't exist.",
+		Fn:     builtinAppendFile,
+	},
+	{
+		Name:     "list_dir",
+		Params:   []Param{param("path", STRING_OBJ)},
+		Optional: 1,
+		Doc:      "Returns the sorted names in a directory, the root by default. Those of directories end in a slash.",
+		Fn:       builtinListDir,
+	},
+	{
+		Name:   "exists",
+		Params: []Param{param("path", STRING_OBJ)},
+		Doc:    "Reports whether a file or directory exists.",
+		Fn:     builtinExists,
+	},
+	{
+		Name:     "print",
+		Params:   []Param{param("values")},
+		Variadic: true,
+		Doc:      "Prints values one after the other, with no newline.",
+		Fn:       builtinPrint,
+	},
+	{
+		Name:     "eprint",
+		Params:   []Param{param("values")},
+		Variadic: true,
+		Doc:      "Prints each value on a line of its own to standard error.",
+		Fn:       builtinEprint,
+	},
+	{
+		Name: "read_line",
+		Doc:  "Reads a line from standard input and returns it without its line ending, or null at the end of the input.",
+		Fn:   builtinReadLine,
+	},
+	{
+		Name:     "help",
+		Params:   []Param{param("fn", BUILTIN_OBJ)},
+		Optional: 1,
+		Doc:      "Prints how a builtin is called and what it does, or the names of all builtins.",
+		Fn:       builtinHelp,
+	},
 }
 
-func newError(format string, a ...interface{}) *Error {
-	return &Error{Message: fmt.Sprintf(format, a...)}
-}
-
-func GetBuiltinByName(name string) *Builtin {
-	for _, def := range Builtins {
-		if def.Name == name {
-			return def.Builtin
+// freeze makes obj, and the arrays and hashes inside it, immutable.
+func freeze(obj Object) {
+	switch obj := obj.(type) {
+	case *Array:
+		if obj.Frozen {
+			return
+		}
+		obj.Frozen = true
+		for _, e := range obj.Elements {
+			freeze(e)
+		}
+	case *Hash:
+		if obj.Frozen {
+			return
+		}
+		obj.Frozen = true
+		for _, pair := range obj.Pairs {
+			freeze(pair.Value)
 		}
 	}
-	return nil
 }
@@ -0,0 +1,88 @@
+package object
+
+import (
+	"strconv"
+	"strings"
+)
+
+// builtinType returns the name of the type of its argument, as Type gives
+// it, except that functions are FUNCTION in the VM too, where Type makes
+// them CLOSURE or COMPILED_FUNCTION_OBJ.
+func builtinType(ctx Context, args ...Object) Object {
+	switch t := args[0].Type(); t {
+	case CLOSURE_OBJ, COMPILED_FUNCTION_OBJ:
+		return &String{Value: string(FUNCTION_OBJ)}
+	default:
+		return &String{Value: string(t)}
+	}
+}
+
+// builtinInt converts an integer, a string of decimal digits or a boolean
+// to an integer.
+func builtinInt(ctx Context, args ...Object) Object {
+	switch arg := args[0].(type) {
+	case *Integer:
+		return arg
+	case *String:
+		value, err := strconv.ParseInt(strings.TrimSpace(arg.Value), 10, 64)
+		if err != nil {
+			if err.(*strconv.NumError).Err == strconv.ErrRange {
+				return NewError(RuntimeError, "%q is out of range for INTEGER", arg.Value)
+			}
+			return NewError(RuntimeError, "cannot convert %q to INTEGER", arg.Value)
+		}
+		return &Integer{Value: value}
+	case *Boolean:
+		if arg.Value {
+			return &Integer{Value: 1}
+		}
+		return &Integer{Value: 0}
+	default:
+		return NewError(TypeError, "cannot convert %s to INTEGER", args[0].Type())
+	}
+}
+
+// builtinStr converts any value to a string, the way puts prints it.
+func builtinStr(ctx Context, args ...Object) Object {
+	if s, ok := args[0].(*String); ok {
+		return s
+	}
+	return &String{Value: args[0].Inspect()}
+}
+
+func builtinBool(ctx Context, args ...Object) Object {
+	if IsTruthy(args[0]) {
+		return TRUE
+	}
+	return FALSE
+}
+
+// builtinArray converts a string to the array of its characters and a range
+// to the array of its elements. An array is copied.
+func builtinArray(ctx Context, args ...Object) Object {
+	switch arg := args[0].(type) {
+	case *Array:
+		elements := make([]Object, len(arg.Elements))
+		copy(elements, arg.Elements)
+		return &Array{Elements: elements}
+	case *String:
+		return builtinChars(ctx, arg)
+	case *Range:
+		elements, err := arg.Elements()
+		if err != nil {
+			return err
+		}
+		return &Array{Elements: elements}
+	default:
+		return NewError(TypeError, "cannot convert %s to ARRAY", args[0].Type())
+	}
+}
+
+func builtinIsCallable(ctx Context, args ...Object) Object {
+	switch args[0].Type() {
+	case FUNCTION_OBJ, CLOSURE_OBJ, COMPILED_FUNCTION_OBJ, BUILTIN_OBJ:
+		return TRUE
+	default:
+		return FALSE
+	}
+}
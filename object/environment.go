@@ -1,8 +1,18 @@
 package object
 
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	store    map[string]Object
+	consts   map[string]bool // names bound by const, which can't be changed
+	outer    *Environment
+	block    bool // the scope of a block, in the same function as outer
+	importer Importer
+	host     *Host
+}
+
+// Importer loads the modules imported by the code evaluated in an
+// environment.
+type Importer interface {
+	Import(path string) Object
 }
 
 func NewEnvironment() *Environment {
@@ -16,6 +26,14 @@ func NewEnclosedEnvironment(outer *Environment) *Environment {
 	return env
 }
 
+// NewBlockEnvironment returns the environment of a block evaluated in outer.
+// Its bindings shadow outer's and end with the block.
+func NewBlockEnvironment(outer *Environment) *Environment {
+	env := NewEnclosedEnvironment(outer)
+	env.block = true
+	return env
+}
+
 func (e *Environment) Get(name string) (Object, bool) {
 	obj, ok := e.store[name]
 	if !ok && e.outer != nil {
@@ -27,3 +45,76 @@ func (e *Environment) Set(name string, val Object) Object {
 	e.store[name] = val
 	return val
 }
+
+// SetConst binds name to val read-only.
+func (e *Environment) SetConst(name string, val Object) Object {
+	if e.consts == nil {
+		e.consts = map[string]bool{}
+	}
+	e.consts[name] = true
+	return e.Set(name, val)
+}
+
+// IsConst reports whether name is bound read-only in e itself.
+func (e *Environment) IsConst(name string) bool {
+	return e.consts[name]
+}
+
+// Assign changes the value of the variable name. The variable must be
+// bound in the function e belongs to, or in the outermost environment, the
+// globals: a function can't assign to the variables of the functions
+// enclosing it.
+func (e *Environment) Assign(name string, val Object) Object {
+	env, local := e, true
+	for env != nil {
+		if _, ok := env.store[name]; ok {
+			break
+		}
+		local = local && env.block
+		env = env.outer
+	}
+	switch {
+	case env == nil:
+		return NewError(NameError, "cannot assign to undefined variable %s", name)
+	case env.IsConst(name):
+		return NewError(TypeError, "cannot assign to constant %s", name)
+	case !local && env.outer != nil:
+		return NewError(NameError, "cannot assign to captured variable %s", name)
+	}
+	return env.Set(name, val)
+}
+
+// Names returns the names bound in e itself, not in the environments
+// enclosing it.
+func (e *Environment) Names() []string {
+	names := make([]string, 0, len(e.store))
+	for name := range e.store {
+		names = append(names, name)
+	}
+	return names
+}
+
+// SetImporter sets the importer used by e and the environments it encloses.
+func (e *Environment) SetImporter(importer Importer) {
+	e.importer = importer
+}
+
+func (e *Environment) Importer() Importer {
+	if e.importer == nil && e.outer != nil {
+		return e.outer.Importer()
+	}
+	return e.importer
+}
+
+// SetHost sets what the builtins called in e and the environments it
+// encloses are provided with.
+func (e *Environment) SetHost(host *Host) {
+	e.host = host
+}
+
+func (e *Environment) Host() *Host {
+	if e.host == nil && e.outer != nil {
+		return e.outer.Host()
+	}
+	return e.host
+}
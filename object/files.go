@@ -0,0 +1,318 @@
+package object
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FileSystem is the backend of the file builtins. The names it's given are
+// slash-separated paths relative to its root, already cleaned and checked
+// not to lead out of it. Errors about a name should be *os.PathErrors.
+type FileSystem interface {
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte) error
+	AppendFile(name string, data []byte) error
+	// ReadDir returns the sorted names in a directory, those of
+	// directories ending in a slash.
+	ReadDir(name string) ([]string, error)
+	Exists(name string) (bool, error)
+}
+
+var errOutside = errors.New("path leads outside the sandbox")
+
+// DirFS is the FileSystem of the directory tree at a root on disk.
+type DirFS string
+
+// path returns the file name of name. It checks that symbolic links don't
+// lead out of the tree, by resolving the deepest part of the path that
+// exists.
+func (d DirFS) path(op, name string) (string, error) {
+	root, err := filepath.EvalSymlinks(string(d))
+	if err != nil {
+		return "", err
+	}
+	file := filepath.Join(root, filepath.FromSlash(name))
+	existing := file
+	for {
+		if _, err := os.Lstat(existing); err == nil || existing == root {
+			break
+		}
+		existing = filepath.Dir(existing)
+	}
+	resolved, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return "", &os.PathError{Op: op, Path: name, Err: err}
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", &os.PathError{Op: op, Path: name, Err: errOutside}
+	}
+	return file, nil
+}
+
+func (d DirFS) ReadFile(name string) ([]byte, error) {
+	file, err := d.path("read", name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(file)
+	return data, pathError("read", name, err)
+}
+
+func (d DirFS) WriteFile(name string, data []byte) error {
+	file, err := d.path("write", name)
+	if err != nil {
+		return err
+	}
+	return pathError("write", name, ioutil.WriteFile(file, data, 0644))
+}
+
+func (d DirFS) AppendFile(name string, data []byte) error {
+	file, err := d.path("append", name)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return pathError("append", name, err)
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return pathError("append", name, err)
+}
+
+func (d DirFS) ReadDir(name string) ([]string, error) {
+	dir, err := d.path("list", name)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, pathError("list", name, err)
+	}
+	names := make([]string, len(infos))
+	for i, info := range infos {
+		names[i] = info.Name()
+		if info.IsDir() {
+			names[i] += "/"
+		}
+	}
+	return names, nil
+}
+
+func (d DirFS) Exists(name string) (bool, error) {
+	file, err := d.path("stat", name)
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(file)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, pathError("stat", name, err)
+}
+
+// pathError puts the name a file has in the FileSystem into an error from
+// the os package about it.
+func pathError(op, name string, err error) error {
+	if pathErr, ok := err.(*os.PathError); ok {
+		return &os.PathError{Op: op, Path: name, Err: pathErr.Err}
+	}
+	return err
+}
+
+// MemFS is a FileSystem in memory, holding the contents of each file by
+// name. Its directories are those with files in them.
+type MemFS map[string][]byte
+
+func (m MemFS) ReadFile(name string) ([]byte, error) {
+	data, ok := m[name]
+	if !ok {
+		return nil, &os.PathError{Op: "read", Path: name, Err: os.ErrNotExist}
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (m MemFS) WriteFile(name string, data []byte) error {
+	if m.isDir(name) {
+		return &os.PathError{Op: "write", Path: name, Err: errors.New("is a directory")}
+	}
+	m[name] = append([]byte(nil), data...)
+	return nil
+}
+
+func (m MemFS) AppendFile(name string, data []byte) error {
+	if m.isDir(name) {
+		return &os.PathError{Op: "append", Path: name, Err: errors.New("is a directory")}
+	}
+	m[name] = append(m[name], data...)
+	return nil
+}
+
+func (m MemFS) ReadDir(name string) ([]string, error) {
+	if !m.isDir(name) {
+		return nil, &os.PathError{Op: "list", Path: name, Err: os.ErrNotExist}
+	}
+	prefix := name + "/"
+	if name == "." {
+		prefix = ""
+	}
+	seen := map[string]bool{}
+	names := []string{}
+	for file := range m {
+		if !strings.HasPrefix(file, prefix) {
+			continue
+		}
+		entry := file[len(prefix):]
+		if i := strings.IndexByte(entry, '/'); i >= 0 {
+			entry = entry[:i+1]
+		}
+		if !seen[entry] {
+			seen[entry] = true
+			names = append(names, entry)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (m MemFS) Exists(name string) (bool, error) {
+	_, ok := m[name]
+	return ok || m.isDir(name), nil
+}
+
+func (m MemFS) isDir(name string) bool {
+	if name == "." {
+		return true
+	}
+	for file := range m {
+		if strings.HasPrefix(file, name+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// The file builtins work in the FileSystem of their Context's Host. Their
+// paths are relative to its root, which they can't lead out of.
+
+func builtinReadFile(ctx Context, args ...Object) Object {
+	files, name, err := fileArguments(ctx, args)
+	if err != nil {
+		return err
+	}
+	data, ioErr := files.ReadFile(name)
+	if ioErr != nil {
+		return fileError(ioErr)
+	}
+	return &String{Value: string(data)}
+}
+
+// builtinReadLines returns the lines of a file, without their line endings.
+func builtinReadLines(ctx Context, args ...Object) Object {
+	contents := builtinReadFile(ctx, args...)
+	s, ok := contents.(*String)
+	if !ok {
+		return contents
+	}
+	if s.Value == "" {
+		return &Array{Elements: []Object{}}
+	}
+	lines := strings.Split(strings.TrimSuffix(s.Value, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	return stringArray(lines)
+}
+
+func builtinWriteFile(ctx Context, args ...Object) Object {
+	files, name, err := fileArguments(ctx, args)
+	if err != nil {
+		return err
+	}
+	if ioErr := files.WriteFile(name, []byte(args[1].(*String).Value)); ioErr != nil {
+		return fileError(ioErr)
+	}
+	return nil
+}
+
+func builtinAppendFile(ctx Context, args ...Object) Object {
+	files, name, err := fileArguments(ctx, args)
+	if err != nil {
+		return err
+	}
+	if ioErr := files.AppendFile(name, []byte(args[1].(*String).Value)); ioErr != nil {
+		return fileError(ioErr)
+	}
+	return nil
+}
+
+// builtinListDir returns the names in a directory, the root if none is
+// given. Those of directories end in a slash.
+func builtinListDir(ctx Context, args ...Object) Object {
+	if len(args) == 0 {
+		args = []Object{&String{Value: "."}}
+	}
+	files, name, err := fileArguments(ctx, args)
+	if err != nil {
+		return err
+	}
+	names, ioErr := files.ReadDir(name)
+	if ioErr != nil {
+		return fileError(ioErr)
+	}
+	return stringArray(names)
+}
+
+func builtinExists(ctx Context, args ...Object) Object {
+	files, name, err := fileArguments(ctx, args)
+	if err != nil {
+		return err
+	}
+	exists, ioErr := files.Exists(name)
+	if ioErr != nil {
+		return fileError(ioErr)
+	}
+	if exists {
+		return TRUE
+	}
+	return FALSE
+}
+
+// fileArguments returns the FileSystem a file builtin uses and the path,
+// its first argument, cleaned.
+func fileArguments(ctx Context, args []Object) (FileSystem, string, *Error) {
+	var files FileSystem
+	if host := ctx.Host(); host != nil {
+		files = host.Files
+	}
+	if files == nil {
+		return nil, "", NewError(IOError, "file access is disabled")
+	}
+	p := args[0].(*String).Value
+	clean := path.Clean(filepath.ToSlash(p))
+	if path.IsAbs(clean) || filepath.IsAbs(p) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return nil, "", NewError(IOError, "path %s leads outside the sandbox", p)
+	}
+	return files, clean, nil
+}
+
+// fileError makes the error a file builtin returns for err, leaving out
+// where the root of the FileSystem is.
+func fileError(err error) *Error {
+	if pathErr, ok := err.(*os.PathError); ok {
+		cause := pathErr.Err
+		if os.IsNotExist(cause) {
+			cause = os.ErrNotExist
+		}
+		return NewError(IOError, "cannot %s %s: %s", pathErr.Op, pathErr.Path, cause)
+	}
+	return NewError(IOError, "%s", err)
+}
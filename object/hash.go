@@ -0,0 +1,76 @@
+package object
+
+// The hash builtins never change the hash they're given: delete and merge
+// return a new one.
+
+func builtinKeys(ctx Context, args ...Object) Object {
+	hash := args[0].(*Hash)
+	keys := make([]Object, len(hash.Keys))
+	for i, pair := range hash.Ordered() {
+		keys[i] = pair.Key
+	}
+	return &Array{Elements: keys}
+}
+
+func builtinValues(ctx Context, args ...Object) Object {
+	hash := args[0].(*Hash)
+	values := make([]Object, len(hash.Keys))
+	for i, pair := range hash.Ordered() {
+		values[i] = pair.Value
+	}
+	return &Array{Elements: values}
+}
+
+// builtinItems returns the pairs of a hash as [key, value] arrays.
+func builtinItems(ctx Context, args ...Object) Object {
+	hash := args[0].(*Hash)
+	items := make([]Object, len(hash.Keys))
+	for i, pair := range hash.Ordered() {
+		items[i] = &Array{Elements: []Object{pair.Key, pair.Value}}
+	}
+	return &Array{Elements: items}
+}
+
+func builtinHas(ctx Context, args ...Object) Object {
+	hash := args[0].(*Hash)
+	key, ok := args[1].(Hashable)
+	if !ok {
+		return NewError(TypeError, "unusable as hash key: %s", args[1].Type())
+	}
+	if _, ok := hash.Pairs[key.HashKey()]; ok {
+		return TRUE
+	}
+	return FALSE
+}
+
+// builtinDelete returns a copy of a hash without the pair for a key.
+func builtinDelete(ctx Context, args ...Object) Object {
+	hash := args[0].(*Hash)
+	key, ok := args[1].(Hashable)
+	if !ok {
+		return NewError(TypeError, "unusable as hash key: %s", args[1].Type())
+	}
+	result := copyHash(hash)
+	result.Delete(key.HashKey())
+	return result
+}
+
+// builtinMerge returns a hash with the pairs of the first hash and then
+// those of the second, whose values win for keys in both.
+func builtinMerge(ctx Context, args ...Object) Object {
+	hash := args[0].(*Hash)
+	other := args[1].(*Hash)
+	result := copyHash(hash)
+	for _, key := range other.Keys {
+		result.Set(key, other.Pairs[key])
+	}
+	return result
+}
+
+func copyHash(hash *Hash) *Hash {
+	result := NewHash()
+	for _, key := range hash.Keys {
+		result.Set(key, hash.Pairs[key])
+	}
+	return result
+}
@@ -0,0 +1,217 @@
+package object
+
+import "sort"
+
+// The builtins here take a collection and a function, which they call back
+// through their Context. An error raised by the function stops them and is
+// returned as their result.
+
+func builtinMap(ctx Context, args ...Object) Object {
+	elements, err := elementsOf(args[0])
+	if err != nil {
+		return err
+	}
+	mapped := make([]Object, len(elements))
+	for i, el := range elements {
+		result := ctx.Call(args[1], el)
+		if isError(result) {
+			return result
+		}
+		mapped[i] = result
+	}
+	return &Array{Elements: mapped}
+}
+
+func builtinFilter(ctx Context, args ...Object) Object {
+	elements, err := elementsOf(args[0])
+	if err != nil {
+		return err
+	}
+	kept := []Object{}
+	for _, el := range elements {
+		result := ctx.Call(args[1], el)
+		if isError(result) {
+			return result
+		}
+		if IsTruthy(result) {
+			kept = append(kept, el)
+		}
+	}
+	return &Array{Elements: kept}
+}
+
+// builtinReduce folds the elements into an accumulator, starting from the
+// initial value if there is one and from the first element otherwise.
+func builtinReduce(ctx Context, args ...Object) Object {
+	elements, err := elementsOf(args[0])
+	if err != nil {
+		return err
+	}
+	var acc Object
+	if len(args) == 3 {
+		acc = args[2]
+	} else if len(elements) > 0 {
+		acc, elements = elements[0], elements[1:]
+	} else {
+		return NewError(TypeError, "reduce of empty %s with no initial value", args[0].Type())
+	}
+	for _, el := range elements {
+		acc = ctx.Call(args[1], acc, el)
+		if isError(acc) {
+			return acc
+		}
+	}
+	return acc
+}
+
+func builtinEach(ctx Context, args ...Object) Object {
+	elements, err := elementsOf(args[0])
+	if err != nil {
+		return err
+	}
+	for _, el := range elements {
+		result := ctx.Call(args[1], el)
+		if isError(result) {
+			return result
+		}
+	}
+	return nil
+}
+
+func builtinAny(ctx Context, args ...Object) Object {
+	elements, err := elementsOf(args[0])
+	if err != nil {
+		return err
+	}
+	for _, el := range elements {
+		result := ctx.Call(args[1], el)
+		if isError(result) {
+			return result
+		}
+		if IsTruthy(result) {
+			return TRUE
+		}
+	}
+	return FALSE
+}
+
+func builtinAll(ctx Context, args ...Object) Object {
+	elements, err := elementsOf(args[0])
+	if err != nil {
+		return err
+	}
+	for _, el := range elements {
+		result := ctx.Call(args[1], el)
+		if isError(result) {
+			return result
+		}
+		if !IsTruthy(result) {
+			return FALSE
+		}
+	}
+	return TRUE
+}
+
+// builtinFind returns the first element the function accepts, or null.
+func builtinFind(ctx Context, args ...Object) Object {
+	elements, err := elementsOf(args[0])
+	if err != nil {
+		return err
+	}
+	for _, el := range elements {
+		result := ctx.Call(args[1], el)
+		if isError(result) {
+			return result
+		}
+		if IsTruthy(result) {
+			return el
+		}
+	}
+	return nil
+}
+
+// builtinSortBy returns the elements sorted by the key the function gives
+// each of them. The sort is stable, and the keys must be all integers or
+// all strings.
+func builtinSortBy(ctx Context, args ...Object) Object {
+	elements, err := elementsOf(args[0])
+	if err != nil {
+		return err
+	}
+	keys := make([]Object, len(elements))
+	for i, el := range elements {
+		key := ctx.Call(args[1], el)
+		if isError(key) {
+			return key
+		}
+		if key.Type() != INTEGER_OBJ && key.Type() != STRING_OBJ {
+			return NewError(TypeError, "sort_by keys must be INTEGER or STRING, got %s", key.Type())
+		}
+		if i > 0 && key.Type() != keys[0].Type() {
+			return NewError(TypeError, "sort_by keys must all have one type, got %s and %s",
+				keys[0].Type(), key.Type())
+		}
+		keys[i] = key
+	}
+
+	order := make([]int, len(elements))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return lessKey(keys[order[i]], keys[order[j]])
+	})
+	sorted := make([]Object, len(elements))
+	for i, index := range order {
+		sorted[i] = elements[index]
+	}
+	return &Array{Elements: sorted}
+}
+
+func lessKey(a, b Object) bool {
+	switch a := a.(type) {
+	case *Integer:
+		return a.Value < b.(*Integer).Value
+	case *String:
+		return a.Value < b.(*String).Value
+	}
+	return false
+}
+
+// elementsOf returns the elements of the collection a builtin goes
+// through: an array, or a value that can be iterated over.
+func elementsOf(collection Object) ([]Object, *Error) {
+	switch arg := collection.(type) {
+	case *Array:
+		return arg.Elements, nil
+	case *Range:
+		return arg.Elements()
+	case Iterable:
+		return drain(arg.Iter())
+	default:
+		return drain(arg.(Iterator))
+	}
+}
+
+// drain collects the values left in iterator.
+func drain(iterator Iterator) ([]Object, *Error) {
+	elements := []Object{}
+	for {
+		value, ok := iterator.Next()
+		if !ok {
+			return elements, nil
+		}
+		if err, ok := value.(*Error); ok {
+			return nil, err
+		}
+		if len(elements) == maxArrayLength {
+			return nil, NewError(RuntimeError, "iterator has too many elements for an array")
+		}
+		elements = append(elements, value)
+	}
+}
+
+func isError(obj Object) bool {
+	_, ok := obj.(*Error)
+	return ok
+}
@@ -0,0 +1,246 @@
+package object
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// JSON objects become hashes with string keys, in the order the keys come
+// in, and numbers become integers; there are no floats yet, so a number
+// with a fraction or an exponent can't be parsed.
+
+func builtinJSONParse(ctx Context, args ...Object) Object {
+	input := args[0].(*String).Value
+	dec := json.NewDecoder(strings.NewReader(input))
+	dec.UseNumber()
+	p := &jsonParser{dec: dec, input: input}
+
+	value := p.parseValue()
+	if p.err != nil {
+		return p.err
+	}
+	rest := input[dec.InputOffset():]
+	if trimmed := strings.TrimLeft(rest, " \t\r\n"); trimmed != "" {
+		offset := int64(len(input) - len(trimmed))
+		return p.errorAt(offset, "unexpected data after the JSON value")
+	}
+	return value
+}
+
+type jsonParser struct {
+	dec   *json.Decoder
+	input string
+	err   *Error
+}
+
+// parseValue parses the next JSON value. It returns nil, with p.err set,
+// when there's an error.
+func (p *jsonParser) parseValue() Object {
+	offset := p.valueStart(p.dec.InputOffset())
+	token, err := p.dec.Token()
+	if err != nil {
+		p.fail(err)
+		return nil
+	}
+	switch token := token.(type) {
+	case json.Delim:
+		if token == '[' {
+			return p.parseArray()
+		}
+		return p.parseObject()
+	case json.Number:
+		value, err := token.Int64()
+		if err != nil {
+			p.err = p.errorAt(offset, "number %s is not an INTEGER", token)
+			return nil
+		}
+		return &Integer{Value: value}
+	case string:
+		return &String{Value: token}
+	case bool:
+		if token {
+			return TRUE
+		}
+		return FALSE
+	default:
+		return NULL
+	}
+}
+
+// valueStart returns where the value the decoder reads next starts, past
+// the whitespace, commas and colons from offset on.
+func (p *jsonParser) valueStart(offset int64) int64 {
+	for offset < int64(len(p.input)) && strings.IndexByte(" \t\r\n,:", p.input[offset]) >= 0 {
+		offset++
+	}
+	return offset
+}
+
+func (p *jsonParser) parseArray() Object {
+	elements := []Object{}
+	for p.dec.More() {
+		value := p.parseValue()
+		if value == nil {
+			return nil
+		}
+		elements = append(elements, value)
+	}
+	if _, err := p.dec.Token(); err != nil {
+		p.fail(err)
+		return nil
+	}
+	return &Array{Elements: elements}
+}
+
+func (p *jsonParser) parseObject() Object {
+	hash := NewHash()
+	for p.dec.More() {
+		token, err := p.dec.Token()
+		if err != nil {
+			p.fail(err)
+			return nil
+		}
+		key := &String{Value: token.(string)}
+		value := p.parseValue()
+		if value == nil {
+			return nil
+		}
+		hash.Set(key.HashKey(), HashPair{Key: key, Value: value})
+	}
+	if _, err := p.dec.Token(); err != nil {
+		p.fail(err)
+		return nil
+	}
+	return hash
+}
+
+// fail records an error from the decoder.
+func (p *jsonParser) fail(err error) {
+	switch err := err.(type) {
+	case *json.SyntaxError:
+		// The offset is just past the offending byte, if there is one.
+		offset := err.Offset
+		end := strings.HasSuffix(err.Error(), "end of JSON input")
+		if offset > 0 && !end {
+			offset--
+		}
+		p.err = p.errorAt(offset, "%s", strings.TrimPrefix(err.Error(), "json: "))
+	default:
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			p.err = NewError(RuntimeError, "invalid JSON: unexpected end of input")
+			return
+		}
+		p.err = p.errorAt(p.dec.InputOffset(), "%s", err)
+	}
+}
+
+// errorAt makes an error for the problem at a byte offset of the input,
+// giving its line and column.
+func (p *jsonParser) errorAt(offset int64, format string, a ...interface{}) *Error {
+	if offset > int64(len(p.input)) {
+		offset = int64(len(p.input))
+	}
+	before := p.input[:offset]
+	line := strings.Count(before, "\n") + 1
+	column := len(before) - strings.LastIndexByte(before, '\n')
+	return NewError(RuntimeError, "invalid JSON at line %d, column %d: %s",
+		line, column, fmt.Sprintf(format, a...))
+}
+
+// builtinJSONStringify encodes a value as JSON. The optional indent, a
+// number of spaces or a string, spreads the result over several lines.
+func builtinJSONStringify(ctx Context, args ...Object) Object {
+	indent := ""
+	if len(args) == 2 {
+		switch arg := args[1].(type) {
+		case *Integer:
+			if arg.Value < 0 {
+				return NewError(RuntimeError, "indent must not be negative, got %d", arg.Value)
+			}
+			indent = strings.Repeat(" ", int(arg.Value))
+		case *String:
+			indent = arg.Value
+		}
+	}
+
+	var buf bytes.Buffer
+	e := &jsonEncoder{buf: &buf, seen: map[Object]bool{}}
+	if err := e.encode(args[0]); err != nil {
+		return err
+	}
+	if indent == "" {
+		return &String{Value: buf.String()}
+	}
+	var out bytes.Buffer
+	json.Indent(&out, buf.Bytes(), "", indent)
+	return &String{Value: out.String()}
+}
+
+type jsonEncoder struct {
+	buf  *bytes.Buffer
+	seen map[Object]bool // the arrays and hashes being encoded
+}
+
+func (e *jsonEncoder) encode(obj Object) *Error {
+	switch obj := obj.(type) {
+	case *Integer:
+		fmt.Fprintf(e.buf, "%d", obj.Value)
+	case *Boolean:
+		fmt.Fprintf(e.buf, "%t", obj.Value)
+	case *Null:
+		e.buf.WriteString("null")
+	case *String:
+		e.encodeString(obj.Value)
+	case *Array:
+		if e.seen[obj] {
+			return NewError(RuntimeError, "cannot encode an ARRAY that contains itself as JSON")
+		}
+		e.seen[obj] = true
+		defer delete(e.seen, obj)
+		e.buf.WriteByte('[')
+		for i, el := range obj.Elements {
+			if i > 0 {
+				e.buf.WriteByte(',')
+			}
+			if err := e.encode(el); err != nil {
+				return err
+			}
+		}
+		e.buf.WriteByte(']')
+	case *Hash:
+		if e.seen[obj] {
+			return NewError(RuntimeError, "cannot encode a HASH that contains itself as JSON")
+		}
+		e.seen[obj] = true
+		defer delete(e.seen, obj)
+		e.buf.WriteByte('{')
+		for i, pair := range obj.Ordered() {
+			key, ok := pair.Key.(*String)
+			if !ok {
+				return NewError(TypeError, "JSON object keys must be STRING, got %s", pair.Key.Type())
+			}
+			if i > 0 {
+				e.buf.WriteByte(',')
+			}
+			e.encodeString(key.Value)
+			e.buf.WriteByte(':')
+			if err := e.encode(pair.Value); err != nil {
+				return err
+			}
+		}
+		e.buf.WriteByte('}')
+	default:
+		return NewError(TypeError, "cannot encode %s as JSON", obj.Type())
+	}
+	return nil
+}
+
+func (e *jsonEncoder) encodeString(s string) {
+	enc := json.NewEncoder(e.buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	e.buf.Truncate(e.buf.Len() - 1) // Encode ends the value with a newline
+}
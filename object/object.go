@@ -1,9 +1,11 @@
 package object
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"io"
 	"strings"
 
 	"waiacig/ast"
@@ -22,9 +24,15 @@ const (
 	RETURN_VALUE_OBJ      = "RETURN_VALUE"
 	QUOTE_OBJ             = "QUOTE"
 	ERROR_OBJ             = "ERROR"
+	EXCEPTION_OBJ         = "EXCEPTION"
 	MACRO_OBJ             = "MACRO"
 	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION_OBJ"
 	CLOSURE_OBJ           = "CLOSURE"
+	GENERATOR_OBJ         = "GENERATOR"
+	MODULE_OBJ            = "MODULE"
+	COMPILED_MODULE_OBJ   = "COMPILED_MODULE"
+	RANGE_OBJ             = "RANGE"
+	REGEX_OBJ             = "REGEX"
 )
 
 type ObjectType string
@@ -60,6 +68,27 @@ type Null struct{}
 func (n *Null) Type() ObjectType { return NULL_OBJ }
 func (n *Null) Inspect() string  { return "null" }
 
+// TRUE, FALSE and NULL are shared by both engines and the builtins, which
+// compare booleans and null by identity.
+var (
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+	NULL  = &Null{}
+)
+
+// IsTruthy reports whether obj counts as true in a condition: anything but
+// false and null does.
+func IsTruthy(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Boolean:
+		return obj.Value
+	case *Null:
+		return false
+	default:
+		return true
+	}
+}
+
 type ReturnValue struct {
 	Value Object
 }
@@ -67,17 +96,103 @@ type ReturnValue struct {
 func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
 func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 
+// Kinds of Error, as seen by a script that catches one.
+const (
+	ThrownError  = "Error"
+	TypeError    = "TypeError"
+	NameError    = "NameError"
+	ArityError   = "ArityError"
+	MatchError   = "MatchError"
+	RuntimeError = "RuntimeError"
+	ImportError  = "ImportError"
+	IOError      = "IOError"
+	// Exit is the kind of the error raised by the exit builtin, which no
+	// catch or finally block sees: it stops the script and ends up with the
+	// host, to which ExitCode gives the script's exit code.
+	Exit = "Exit"
+)
+
+// Error is a runtime error, or a value thrown by a script, on its way to
+// the nearest catch. It also satisfies Go's error interface, which is how
+// the VM reports it.
 type Error struct {
+	Kind    string
 	Message string
+	Value   Object // the thrown value; nil for errors raised by the runtime
+	Code    int    // the exit code of an Exit
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
 func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
+func (e *Error) Error() string    { return e.Message }
+
+func NewError(kind string, format string, a ...interface{}) *Error {
+	return &Error{Kind: kind, Message: fmt.Sprintf(format, a...)}
+}
+
+// NewInfixError makes the error for an infix operator its operands don't
+// support, a type mismatch if their types differ. Both engines raise it,
+// so a script sees the same message from either.
+func NewInfixError(left Object, operator string, right Object) *Error {
+	if left.Type() != right.Type() {
+		return NewError(TypeError, "type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	}
+	return NewError(TypeError, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+}
+
+// NewPrefixError makes the error for a prefix operator its operand doesn't
+// support.
+func NewPrefixError(operator string, right Object) *Error {
+	return NewError(TypeError, "unknown operator: %s%s", operator, right.Type())
+}
+
+// ExitCode reports whether err is an Exit raised by a script, and if so
+// with what code.
+func ExitCode(err error) (int, bool) {
+	e, ok := err.(*Error)
+	if !ok || e.Kind != Exit {
+		return 0, false
+	}
+	return e.Code, true
+}
+
+// Throw wraps a value thrown by a script. Rethrowing a caught Exception
+// keeps its kind.
+func Throw(value Object) *Error {
+	if ex, ok := value.(*Exception); ok {
+		return &Error{Kind: ex.Kind, Message: ex.Message, Value: ex}
+	}
+	return &Error{Kind: ThrownError, Message: value.Inspect(), Value: value}
+}
+
+// Caught returns the value a catch clause binds for e: the thrown value, or
+// an Exception describing an error raised by the runtime.
+func (e *Error) Caught() Object {
+	if e.Value != nil {
+		return e.Value
+	}
+	return &Exception{Kind: e.Kind, Message: e.Message}
+}
+
+// Exception is a caught runtime error. Indexing it with "kind" or "message"
+// gives its parts.
+type Exception struct {
+	Kind    string
+	Message string
+}
+
+func (ex *Exception) Type() ObjectType { return EXCEPTION_OBJ }
+func (ex *Exception) Inspect() string  { return ex.Kind + ": " + ex.Message }
 
 type Function struct {
-	Parameters []*ast.Identifier
-	Body       *ast.BlockStatement
-	Env        *Environment
+	Parameters  []*ast.Identifier
+	Patterns    []ast.Pattern
+	Defaults    []ast.Expression
+	Rest        *ast.Identifier
+	Body        *ast.BlockStatement
+	Env         *Environment
+	IsGenerator bool
+	Name        string // the name of a declared function, for error messages
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
@@ -88,6 +203,9 @@ func (f *Function) Inspect() string {
 		params = append(params, p.String())
 	}
 	out.WriteString("fn")
+	if f.Name != "" {
+		out.WriteString(" " + f.Name)
+	}
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") {\n")
@@ -96,10 +214,53 @@ func (f *Function) Inspect() string {
 	return out.String()
 }
 
-type BuiltinFunction func(args ...Object) Object
+// Context is the engine running a builtin, which the builtin can call back
+// into.
+type Context interface {
+	// Call applies fn, a function value, to args, returning its result or
+	// the *Error it raised.
+	Call(fn Object, args ...Object) Object
+	// Host returns what the embedding program provides to builtins, or
+	// nil if it provides nothing.
+	Host() *Host
+}
+
+// Host is what the program embedding the interpreter provides to the
+// builtins. The zero Host gives them the process's standard streams and
+// no files.
+type Host struct {
+	// Files is the file system the file builtins work in. They're turned
+	// off when it's nil. Imported modules aren't read through it.
+	Files FileSystem
+
+	// The streams the builtins print to and read from, or nil for the
+	// process's own.
+	Stdout io.Writer
+	Stderr io.Writer
+	Stdin  io.Reader
+
+	stdin *bufio.Reader // reads Stdin for read_line
 
+	functions []*Builtin // registered by the embedder
+}
+
+// BuiltinFunction implements a builtin. It's only called with arguments
+// that fit the builtin's parameters.
+type BuiltinFunction func(ctx Context, args ...Object) Object
+
+// Builtin is a function provided by the interpreter rather than written in
+// a script. Its parameters say what arguments it takes; Call checks them
+// before running Fn.
 type Builtin struct {
-	Fn BuiltinFunction
+	Name   string
+	Params []Param
+	// Optional is how many of the last Params can be left out.
+	Optional int
+	// Variadic builtins take any number of arguments, including none, for
+	// their last parameter.
+	Variadic bool
+	Doc      string
+	Fn       BuiltinFunction
 }
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
@@ -107,6 +268,7 @@ func (b *Builtin) Inspect() string  { return "builtin function" }
 
 type Array struct {
 	Elements []Object
+	Frozen   bool // set by freeze; the array can't be changed
 }
 
 func (a *Array) Type() ObjectType { return ARRAY_OBJ }
@@ -123,6 +285,19 @@ func (a *Array) Inspect() string {
 	return out.String()
 }
 
+// Iter returns an iterator over the elements of the array, which sees
+// elements added while it's in use.
+func (a *Array) Iter() Iterator {
+	var i int
+	return &Generator{Resume: func() (Object, bool) {
+		if i >= len(a.Elements) {
+			return nil, false
+		}
+		i++
+		return a.Elements[i-1], true
+	}}
+}
+
 type HashKey struct {
 	Type  ObjectType
 	Value uint64
@@ -155,15 +330,54 @@ type HashPair struct {
 	Value Object
 }
 
+// Hash keeps its pairs in the order their keys were first added. Hashes are
+// changed through Set and Delete, which keep Keys in step with Pairs.
 type Hash struct {
-	Pairs map[HashKey]HashPair
+	Pairs  map[HashKey]HashPair
+	Keys   []HashKey // the keys of Pairs in insertion order
+	Frozen bool      // set by freeze; the hash can't be changed
+}
+
+func NewHash() *Hash {
+	return &Hash{Pairs: map[HashKey]HashPair{}}
+}
+
+// Set adds the pair under key, or replaces the pair already there, which
+// keeps its place in the order.
+func (h *Hash) Set(key HashKey, pair HashPair) {
+	if _, ok := h.Pairs[key]; !ok {
+		h.Keys = append(h.Keys, key)
+	}
+	h.Pairs[key] = pair
+}
+
+func (h *Hash) Delete(key HashKey) {
+	if _, ok := h.Pairs[key]; !ok {
+		return
+	}
+	delete(h.Pairs, key)
+	for i, k := range h.Keys {
+		if k == key {
+			h.Keys = append(h.Keys[:i:i], h.Keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// Ordered returns the pairs in insertion order.
+func (h *Hash) Ordered() []HashPair {
+	pairs := make([]HashPair, len(h.Keys))
+	for i, key := range h.Keys {
+		pairs[i] = h.Pairs[key]
+	}
+	return pairs
 }
 
 func (h *Hash) Type() ObjectType { return HASH_OBJ }
 func (h *Hash) Inspect() string {
 	var out bytes.Buffer
 	pairs := []string{}
-	for _, pair := range h.Pairs {
+	for _, pair := range h.Ordered() {
 		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), pair.Value.Inspect()))
 	}
 	out.WriteString("{")
@@ -172,6 +386,37 @@ func (h *Hash) Inspect() string {
 	return out.String()
 }
 
+// SetIndex changes left[index] to value, in place. Arrays can only be
+// assigned at existing indexes.
+func SetIndex(left, index, value Object) Object {
+	switch left := left.(type) {
+	case *Array:
+		if left.Frozen {
+			return NewError(TypeError, "cannot modify frozen %s", left.Type())
+		}
+		i, ok := index.(*Integer)
+		if !ok {
+			return NewError(TypeError, "array index must be INTEGER, got %s", index.Type())
+		}
+		if i.Value < 0 || i.Value >= int64(len(left.Elements)) {
+			return NewError(RuntimeError, "index out of range: %d", i.Value)
+		}
+		left.Elements[i.Value] = value
+	case *Hash:
+		if left.Frozen {
+			return NewError(TypeError, "cannot modify frozen %s", left.Type())
+		}
+		key, ok := index.(Hashable)
+		if !ok {
+			return NewError(TypeError, "unusable as hash key: %s", index.Type())
+		}
+		left.Set(key.HashKey(), HashPair{Key: index, Value: value})
+	default:
+		return NewError(TypeError, "index assignment not supported: %s", left.Type())
+	}
+	return value
+}
+
 type Quote struct {
 	Node ast.Node
 }
@@ -210,6 +455,17 @@ type CompiledFunction struct {
 	Instructions  code.Instructions
 	NumLocals     int
 	NumParameters int
+	// NumDefaults counts the trailing parameters that have default values.
+	NumDefaults int
+	// Variadic functions collect extra arguments into an array held in the
+	// local after the parameters.
+	Variadic bool
+	// ParameterNames is used to bind keyword arguments.
+	ParameterNames []string
+	// Generator functions return a Generator instead of running their body
+	// when called.
+	Generator bool
+	Name      string // the name of a declared function, for error messages
 }
 
 func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
@@ -217,9 +473,64 @@ func (cf *CompiledFunction) Inspect() string {
 	return fmt.Sprintf("CompiledFunction[%p]", cf)
 }
 
+// Iterator is implemented by objects that produce a sequence of values one
+// at a time. Next returns false once the sequence is exhausted; a failure
+// while producing a value is reported by returning an *Error.
+type Iterator interface {
+	Object
+	Next() (Object, bool)
+}
+
+// Generator is an iterator whose values come from Resume. Calling a
+// generator function returns one, with a Resume supplied by the engine that
+// runs the function up to its next yield.
+type Generator struct {
+	Resume func() (Object, bool)
+}
+
+func (g *Generator) Type() ObjectType     { return GENERATOR_OBJ }
+func (g *Generator) Inspect() string      { return "generator" }
+func (g *Generator) Next() (Object, bool) { return g.Resume() }
+
+// Module is the value of an import. Its exports are read like the fields of
+// a hash, and calling one as a method doesn't pass the module to it.
+type Module struct {
+	Name    string
+	Exports map[string]Object
+}
+
+func (m *Module) Type() ObjectType { return MODULE_OBJ }
+func (m *Module) Inspect() string  { return fmt.Sprintf("module(%q)", m.Name) }
+
+// Member returns the export called name, or an error if there isn't one.
+func (m *Module) Member(name string) Object {
+	if value, ok := m.Exports[name]; ok {
+		return value
+	}
+	return NewError(NameError, "module %q has no export %s", m.Name, name)
+}
+
+// CompiledModule is the top-level code of a module, run by the first import
+// of it with globals of its own.
+type CompiledModule struct {
+	Name         string
+	Instructions code.Instructions
+	NumGlobals   int
+	NumLocals    int
+	// Exports maps the name of each exported binding to its global index.
+	Exports map[string]int
+}
+
+func (cm *CompiledModule) Type() ObjectType { return COMPILED_MODULE_OBJ }
+func (cm *CompiledModule) Inspect() string {
+	return fmt.Sprintf("CompiledModule[%s]", cm.Name)
+}
+
 type Closure struct {
 	Fn   *CompiledFunction
 	Free []Object
+	// Globals are the globals of the module the closure was created in.
+	Globals []Object
 }
 
 func (c *Closure) Type() ObjectType { return CLOSURE_OBJ }
@@ -1,6 +1,11 @@
 package object
 
 import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 )
 
@@ -20,3 +25,394 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("strings with different content have same hash keys")
 	}
 }
+
+func TestRangeSlicing(t *testing.T) {
+	null := &Null{}
+	ten := &Range{Start: 0, End: 10, Step: 1}
+	tests := []struct {
+		start, end, step Object
+		expected         []int64
+	}{
+		{null, null, null, []int64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}},
+		{&Integer{Value: 2}, &Integer{Value: 5}, null, []int64{2, 3, 4}},
+		{&Integer{Value: -3}, null, null, []int64{7, 8, 9}},
+		{null, null, &Integer{Value: 3}, []int64{0, 3, 6, 9}},
+		{null, null, &Integer{Value: -4}, []int64{9, 5, 1}},
+		{&Integer{Value: 8}, &Integer{Value: 2}, null, []int64{}},
+		{&Integer{Value: -100}, &Integer{Value: 100}, &Integer{Value: 5}, []int64{0, 5}},
+	}
+	for i, tt := range tests {
+		sliced, ok := Slice(ten, tt.start, tt.end, tt.step).(*Range)
+		if !ok {
+			t.Fatalf("tests[%d] - slice is not a Range", i)
+		}
+		if sliced.Len() != int64(len(tt.expected)) {
+			t.Errorf("tests[%d] - wrong length. want=%d, got=%d (%s)",
+				i, len(tt.expected), sliced.Len(), sliced.Inspect())
+			continue
+		}
+		for j, want := range tt.expected {
+			if got, _ := sliced.Index(int64(j)); got != want {
+				t.Errorf("tests[%d] - wrong element %d. want=%d, got=%d", i, j, want, got)
+			}
+		}
+	}
+}
+
+func TestHashOrder(t *testing.T) {
+	hash := NewHash()
+	for _, key := range []string{"c", "a", "b", "a", "d"} {
+		k := &String{Value: key}
+		hash.Set(k.HashKey(), HashPair{Key: k, Value: &Integer{Value: int64(len(hash.Keys))}})
+	}
+	hash.Delete((&String{Value: "b"}).HashKey())
+	hash.Delete((&String{Value: "missing"}).HashKey())
+
+	if hash.Inspect() != "{c: 0, a: 3, d: 3}" {
+		t.Errorf("wrong hash. got=%s", hash.Inspect())
+	}
+}
+
+func TestJSON(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"b": [1, true, null, "x\"y"], "a": {"c": -2}}`, `{b: [1, true, null, x"y], a: {c: -2}}`},
+		{`  []  `, `[]`},
+		{`{"a": 1,` + "\n" + ` "b": ]}`, "invalid JSON at line 2, column 7: invalid character ']' after object key:value pair"},
+		{`[1, 2`, "invalid JSON at line 1, column 6: unexpected end of JSON input"},
+		{``, "invalid JSON: unexpected end of input"},
+		{`[1.5]`, "invalid JSON at line 1, column 2: number 1.5 is not an INTEGER"},
+		{`[1, 2.5]`, "invalid JSON at line 1, column 5: number 2.5 is not an INTEGER"},
+		{`{"a": 1,` + "\n" + `  "b" :  2e3}`, "invalid JSON at line 2, column 10: number 2e3 is not an INTEGER"},
+		{`[1] 2`, "invalid JSON at line 1, column 5: unexpected data after the JSON value"},
+	}
+
+	for _, tt := range tests {
+		parsed := builtinJSONParse(nil, &String{Value: tt.input})
+		if err, ok := parsed.(*Error); ok {
+			if err.Message != tt.expected {
+				t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, err.Message)
+			}
+			continue
+		}
+		if parsed.Inspect() != tt.expected {
+			t.Errorf("wrong value for %q. expected=%q, got=%q", tt.input, tt.expected, parsed.Inspect())
+		}
+	}
+
+	hash := builtinJSONParse(nil, &String{Value: `{"z": ["<&>", "é\n"], "a": {}}`})
+	encoded := builtinJSONStringify(nil, hash).(*String).Value
+	if encoded != `{"z":["<&>","é\n"],"a":{}}` {
+		t.Errorf("wrong encoding. got=%s", encoded)
+	}
+}
+
+func TestDirFS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dirfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	root := filepath.Join(dir, "root")
+	os.Mkdir(root, 0755)
+	ioutil.WriteFile(filepath.Join(dir, "secret"), []byte("s"), 0644)
+	if err := os.Symlink(dir, filepath.Join(root, "up")); err != nil {
+		t.Skipf("cannot make symlink: %s", err)
+	}
+	files := DirFS(root)
+
+	if err := files.WriteFile("a.txt", []byte("a")); err != nil {
+		t.Fatalf("write failed: %s", err)
+	}
+	if data, err := files.ReadFile("a.txt"); err != nil || string(data) != "a" {
+		t.Errorf("wrong contents. got=%q (%v)", data, err)
+	}
+	if _, err := files.ReadFile("up/secret"); err == nil || err.Error() != "read up/secret: path leads outside the sandbox" {
+		t.Errorf("symlink out of root followed. got=%v", err)
+	}
+	if err := files.WriteFile("up/new", nil); err == nil {
+		t.Errorf("write through symlink out of root succeeded")
+	}
+	if _, err := files.ReadFile("missing"); err == nil || err.Error() != "read missing: no such file or directory" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
+
+func TestBuiltinRegistry(t *testing.T) {
+	for i, b := range Builtins {
+		if b.Doc == "" {
+			t.Errorf("builtin %s has no doc", b.Name)
+		}
+		if GetBuiltinByName(b.Name) != b {
+			t.Errorf("builtin %d is not found by its name %s", i, b.Name)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		args      []Object
+		signature string
+		expected  string
+	}{
+		{"len", []Object{}, "len(value: ARRAY, STRING, RANGE or HASH)",
+			"wrong number of arguments. got=0, want=1"},
+		{"len", []Object{TRUE}, "len(value: ARRAY, STRING, RANGE or HASH)",
+			"argument to `len` must be ARRAY, STRING, RANGE or HASH, got BOOLEAN"},
+		{"reduce", []Object{&Array{}}, "reduce(collection: iterable, fn, initial?)",
+			"wrong number of arguments. got=1, want=2 or 3"},
+		{"map", []Object{TRUE, TRUE}, "map(collection: iterable, fn)",
+			"argument to `map` must be iterable, got BOOLEAN"},
+		{"repeat", []Object{&String{Value: "a"}, &String{Value: "b"}}, "repeat(s: STRING, count: INTEGER)",
+			"argument 2 to `repeat` must be INTEGER, got STRING"},
+		{"format", []Object{}, "format(format: STRING, ...values)",
+			"wrong number of arguments. got=0, want=at least 1"},
+		{"format", []Object{&String{Value: "%d %d"}, &Integer{Value: 1}, TRUE}, "format(format: STRING, ...values)",
+			"format verb %d not supported for BOOLEAN"},
+		{"read_line", []Object{NULL}, "read_line()",
+			"wrong number of arguments. got=1, want=0"},
+	}
+
+	for _, tt := range tests {
+		b := GetBuiltinByName(tt.name)
+		if sig := b.Signature(); sig != tt.signature {
+			t.Errorf("wrong signature for %s. expected=%q, got=%q", tt.name, tt.signature, sig)
+		}
+		err, ok := b.Call(nil, tt.args...).(*Error)
+		if !ok {
+			t.Errorf("no error from %s with %d arguments", tt.name, len(tt.args))
+			continue
+		}
+		if err.Message != tt.expected {
+			t.Errorf("wrong error from %s. expected=%q, got=%q", tt.name, tt.expected, err.Message)
+		}
+	}
+}
+
+func TestHostRegister(t *testing.T) {
+	fn := func(ctx Context, args ...Object) Object { return nil }
+	host := &Host{}
+	tests := []struct {
+		builtin  *Builtin
+		expected string
+	}{
+		{&Builtin{Name: "lookup_user", Fn: fn}, ""},
+		{&Builtin{Name: "lookup_user", Fn: fn}, "cannot register lookup_user: the name is taken"},
+		{&Builtin{Name: "len", Fn: fn}, "cannot register len: the name is taken"},
+		{&Builtin{Name: "fn", Fn: fn}, `cannot register "fn": not a valid name`},
+		{&Builtin{Name: "user2", Fn: fn}, `cannot register "user2": not a valid name`},
+		{&Builtin{Name: "", Fn: fn}, `cannot register "": not a valid name`},
+		{&Builtin{Name: "nothing"}, "cannot register nothing: no function"},
+		{&Builtin{Name: "save_user", Fn: fn}, ""},
+	}
+
+	for _, tt := range tests {
+		err := host.Register(tt.builtin)
+		if tt.expected == "" && err != nil || tt.expected != "" && (err == nil || err.Error() != tt.expected) {
+			t.Errorf("wrong error registering %q. expected=%q, got=%v", tt.builtin.Name, tt.expected, err)
+		}
+	}
+
+	n := len(Builtins)
+	if all := host.Builtins(); len(all) != n+2 || all[n].Name != "lookup_user" || all[n+1].Name != "save_user" {
+		t.Errorf("wrong builtins of the host: %d of them", len(all))
+	}
+	if host.Builtin(n+1) != host.Lookup("save_user") || host.Builtin(0) != GetBuiltinByName("len") {
+		t.Errorf("builtins by index and by name disagree")
+	}
+	if host.Builtin(n+2) != nil || (*Host)(nil).Builtin(n) != nil || (*Host)(nil).Lookup("save_user") != nil {
+		t.Errorf("found a builtin that isn't registered")
+	}
+	if len(Builtins) != n {
+		t.Errorf("registering changed Builtins")
+	}
+}
+
+type testAddress struct {
+	City string `monkey:"city"`
+	Zip  int    `monkey:"zip"`
+}
+
+type testUser struct {
+	Name    string         `monkey:"name"`
+	Age     uint8          `monkey:"age"`
+	Admin   bool           `monkey:"admin"`
+	Tags    []string       `monkey:"tags"`
+	Address *testAddress   `monkey:"address"`
+	Scores  map[string]int `monkey:"scores"`
+	Secret  string         `monkey:"-"`
+	Extra   interface{}
+	note    string
+}
+
+func TestFromGo(t *testing.T) {
+	tests := []struct {
+		input    interface{}
+		expected string
+	}{
+		{nil, "null"},
+		{int8(-3), "-3"},
+		{uint64(1 << 63), "9223372036854775808 overflows INTEGER"},
+		{"hi", "hi"},
+		{[]bool{true, false}, "[true, false]"},
+		{[2]int{1, 2}, "[1, 2]"},
+		{map[int]string{2: "b", 1: "a"}, "{1: a, 2: b}"},
+		{(*testAddress)(nil), "null"},
+		{&testUser{
+			Name:    "ann",
+			Age:     30,
+			Tags:    []string{"x"},
+			Address: &testAddress{City: "Oslo", Zip: 150},
+			Secret:  "s",
+			Extra:   []interface{}{1, "two", &Integer{Value: 3}},
+			note:    "n",
+		}, "{name: ann, age: 30, admin: false, tags: [x], address: {city: Oslo, zip: 150}, " +
+			"scores: null, Extra: [1, two, 3]}"},
+		{map[string][]chan int{"a": {nil}}, "[a][0]: cannot convert chan int to an object"},
+		{testUser{Extra: map[string]uint{"big": 1 << 63}}, "Extra[big]: 9223372036854775808 overflows INTEGER"},
+	}
+
+	for _, tt := range tests {
+		obj, err := FromGo(tt.input)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		} else {
+			got = obj.Inspect()
+		}
+		if got != tt.expected {
+			t.Errorf("wrong result for %#v. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	type node struct{ Next *node }
+	loop := &node{}
+	loop.Next = loop
+	if _, err := FromGo(loop); err == nil || err.Error() != "Next: cannot convert a *object.node that contains itself" {
+		t.Errorf("wrong error for a cycle: %v", err)
+	}
+
+	s := []interface{}{nil}
+	s[0] = s
+	if _, err := FromGo(s); err == nil || err.Error() != "[0]: cannot convert a []interface {} that contains itself" {
+		t.Errorf("wrong error for a slice cycle: %v", err)
+	}
+	shared := []int{1}
+	if obj, err := FromGo([][]int{shared, shared}); err != nil || obj.Inspect() != "[[1], [1]]" {
+		t.Errorf("wrong result for a shared slice. got=%v and %v", obj, err)
+	}
+}
+
+func TestToGo(t *testing.T) {
+	user, err := FromGo(testUser{
+		Name:    "ann",
+		Age:     30,
+		Admin:   true,
+		Tags:    []string{"x", "y"},
+		Address: &testAddress{City: "Oslo", Zip: 150},
+		Scores:  map[string]int{"go": 3},
+		Extra:   map[string]interface{}{"n": []interface{}{int64(1), nil}},
+	})
+	if err != nil {
+		t.Fatalf("FromGo error: %s", err)
+	}
+	var back testUser
+	if err := ToGo(user, &back); err != nil {
+		t.Fatalf("ToGo error: %s", err)
+	}
+	expected := testUser{
+		Name:    "ann",
+		Age:     30,
+		Admin:   true,
+		Tags:    []string{"x", "y"},
+		Address: &testAddress{City: "Oslo", Zip: 150},
+		Scores:  map[string]int{"go": 3},
+		Extra:   map[string]interface{}{"n": []interface{}{int64(1), nil}},
+	}
+	if !reflect.DeepEqual(back, expected) {
+		t.Errorf("wrong value. expected=%+v, got=%+v", expected, back)
+	}
+
+	var arr *Array
+	tags := user.(*Hash).Pairs[(&String{Value: "tags"}).HashKey()].Value
+	if err := ToGo(tags, &arr); err != nil || len(arr.Elements) != 2 {
+		t.Errorf("wrong ARRAY kept as an object: %v, %v", arr, err)
+	}
+
+	hash := func(pairs ...Object) Object {
+		h := NewHash()
+		for i := 0; i < len(pairs); i += 2 {
+			h.Set(pairs[i].(Hashable).HashKey(), HashPair{Key: pairs[i], Value: pairs[i+1]})
+		}
+		return h
+	}
+	str := func(s string) Object { return &String{Value: s} }
+	tests := []struct {
+		input    Object
+		target   interface{}
+		expected string
+	}{
+		{hash(str("age"), str("old")), &testUser{}, "age: cannot convert STRING to uint8"},
+		{hash(str("age"), &Integer{Value: 300}), &testUser{}, "age: 300 overflows uint8"},
+		{hash(str("tags"), &Array{Elements: []Object{str("a"), TRUE}}), &testUser{}, "tags[1]: cannot convert BOOLEAN to string"},
+		{hash(str("address"), hash(str("zip"), NULL)), &testUser{}, "address.zip: cannot convert NULL to int"},
+		{hash(str("scores"), hash(str("go"), str("3"))), &testUser{}, "scores[go]: cannot convert STRING to int"},
+		{hash(str("Extra"), hash(&Integer{Value: 1}, TRUE)), &testUser{}, "Extra: cannot convert a HASH with INTEGER keys to map[string]interface {}"},
+		{&Array{Elements: []Object{TRUE}}, &[2]bool{}, "cannot convert ARRAY of 1 elements to [2]bool"},
+		{TRUE, testUser{}, "ToGo needs a non-nil pointer, got object.testUser"},
+	}
+
+	for _, tt := range tests {
+		err := ToGo(tt.input, tt.target)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for %s. expected=%q, got=%v", tt.input.Inspect(), tt.expected, err)
+		}
+	}
+}
+
+func TestWrapFunc(t *testing.T) {
+	add, err := WrapFunc("add", func(a int, rest ...int) int {
+		for _, b := range rest {
+			a += b
+		}
+		return a
+	})
+	if err != nil {
+		t.Fatalf("WrapFunc error: %s", err)
+	}
+	if sig := add.Signature(); sig != "add(arg1: INTEGER, ...arg2: INTEGER)" {
+		t.Errorf("wrong signature. got=%q", sig)
+	}
+	if got := add.Call(nil, &Integer{Value: 1}, &Integer{Value: 2}, &Integer{Value: 3}); got.Inspect() != "6" {
+		t.Errorf("wrong result. got=%s", got.Inspect())
+	}
+
+	find, _ := WrapFunc("find", func(tags []int8) (*testAddress, error) {
+		if len(tags) == 0 {
+			return nil, errors.New("no tags")
+		}
+		return &testAddress{City: "Oslo"}, nil
+	})
+	tests := []struct {
+		args     []Object
+		expected string
+	}{
+		{[]Object{&Array{Elements: []Object{&Integer{Value: 1}}}}, "{city: Oslo, zip: 0}"},
+		{[]Object{&Array{Elements: []Object{}}}, "ERROR: no tags"},
+		{[]Object{&Array{Elements: []Object{&Integer{Value: 1000}}}}, "ERROR: argument 1 to `find`: [0]: 1000 overflows int8"},
+		{[]Object{&Integer{Value: 1}}, "ERROR: argument to `find` must be ARRAY, got INTEGER"},
+	}
+	for _, tt := range tests {
+		if got := find.Call(nil, tt.args...).Inspect(); got != tt.expected {
+			t.Errorf("wrong result. expected=%q, got=%q", tt.expected, got)
+		}
+	}
+
+	if _, err := WrapFunc("pair", func() (int, int) { return 1, 2 }); err == nil {
+		t.Errorf("no error wrapping a func returning two values")
+	}
+	if _, err := WrapFunc("one", 1); err == nil || err.Error() != "cannot wrap int as a builtin: not a func" {
+		t.Errorf("wrong error wrapping an int: %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package object
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+)
+
+// stdin reads the process's standard input for hosts that don't set their
+// own. It's made when first needed.
+var stdin *bufio.Reader
+
+// builtinPuts prints each of its arguments on a line of its own.
+func builtinPuts(ctx Context, args ...Object) Object {
+	return printLines(stdoutOf(ctx), args)
+}
+
+// builtinPrint prints its arguments one after the other, with no newline.
+func builtinPrint(ctx Context, args ...Object) Object {
+	var out strings.Builder
+	for _, arg := range args {
+		out.WriteString(arg.Inspect())
+	}
+	return write(stdoutOf(ctx), out.String())
+}
+
+// builtinEprint prints its arguments to standard error as puts does to
+// standard output.
+func builtinEprint(ctx Context, args ...Object) Object {
+	return printLines(stderrOf(ctx), args)
+}
+
+// builtinReadLine reads a line from standard input and returns it without
+// its line ending, or null at the end of the input.
+func builtinReadLine(ctx Context, args ...Object) Object {
+	line, err := stdinOf(ctx).ReadString('\n')
+	if err == io.EOF && line == "" {
+		return nil
+	}
+	if err != nil && err != io.EOF {
+		return NewError(IOError, "cannot read standard input: %s", err)
+	}
+	line = strings.TrimSuffix(line, "\n")
+	return &String{Value: strings.TrimSuffix(line, "\r")}
+}
+
+func printLines(w io.Writer, args []Object) Object {
+	var out strings.Builder
+	for _, arg := range args {
+		out.WriteString(arg.Inspect())
+		out.WriteByte('\n')
+	}
+	return write(w, out.String())
+}
+
+func write(w io.Writer, s string) Object {
+	if _, err := io.WriteString(w, s); err != nil {
+		return NewError(IOError, "cannot write output: %s", err)
+	}
+	return nil
+}
+
+func stdoutOf(ctx Context) io.Writer {
+	if host := ctx.Host(); host != nil && host.Stdout != nil {
+		return host.Stdout
+	}
+	return os.Stdout
+}
+
+func stderrOf(ctx Context) io.Writer {
+	if host := ctx.Host(); host != nil && host.Stderr != nil {
+		return host.Stderr
+	}
+	return os.Stderr
+}
+
+// stdinOf returns the reader of the standard input of ctx's host, which
+// lasts as long as the host, so that nothing read ahead of a line is lost.
+func stdinOf(ctx Context) *bufio.Reader {
+	host := ctx.Host()
+	if host == nil || host.Stdin == nil {
+		if stdin == nil {
+			stdin = bufio.NewReader(os.Stdin)
+		}
+		return stdin
+	}
+	if host.stdin == nil {
+		if r, ok := host.Stdin.(*bufio.Reader); ok {
+			host.stdin = r
+		} else {
+			host.stdin = bufio.NewReader(host.Stdin)
+		}
+	}
+	return host.stdin
+}
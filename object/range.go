@@ -0,0 +1,210 @@
+package object
+
+import (
+	"fmt"
+	"math"
+)
+
+// Range is the sequence of integers from Start up to, but not including,
+// End, counting by Step. Its elements are worked out as they're used, so a
+// range of any length takes the same space.
+type Range struct {
+	Start int64
+	End   int64
+	Step  int64
+}
+
+func (r *Range) Type() ObjectType { return RANGE_OBJ }
+func (r *Range) Inspect() string {
+	if r.Step == 1 {
+		return fmt.Sprintf("%d..%d", r.Start, r.End)
+	}
+	return fmt.Sprintf("(%d..%d)[::%d]", r.Start, r.End, r.Step)
+}
+
+// NewRange makes the range start..end, counting up by one.
+func NewRange(start, end Object) Object {
+	s, ok := start.(*Integer)
+	e, ok2 := end.(*Integer)
+	if !ok || !ok2 {
+		return NewError(TypeError, "range bounds must be INTEGER, got %s and %s",
+			start.Type(), end.Type())
+	}
+	return &Range{Start: s.Value, End: e.Value, Step: 1}
+}
+
+// Len returns the number of elements in the range, or math.MaxInt64 if
+// there are more.
+func (r *Range) Len() int64 {
+	var span, step uint64
+	switch {
+	case r.Step > 0 && r.End > r.Start:
+		span, step = uint64(r.End)-uint64(r.Start), uint64(r.Step)
+	case r.Step < 0 && r.Start > r.End:
+		span, step = uint64(r.Start)-uint64(r.End), -uint64(r.Step)
+	default:
+		return 0
+	}
+	n := span / step
+	if span%step != 0 {
+		n++
+	}
+	if n > math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return int64(n)
+}
+
+// Index returns the element at i, which must be in [0, Len()).
+func (r *Range) Index(i int64) (int64, bool) {
+	if i < 0 || i >= r.Len() {
+		return 0, false
+	}
+	return r.Start + i*r.Step, true
+}
+
+// maxArrayLength is the most elements a builtin or spread will collect
+// into an array, so that a huge range or endless generator makes an error
+// rather than use up the host's memory.
+const maxArrayLength = 1 << 24
+
+// Elements returns the elements of the range in an array, or an error if
+// there are more than an array may be made with.
+func (r *Range) Elements() ([]Object, *Error) {
+	n := r.Len()
+	if n > maxArrayLength {
+		return nil, NewError(RuntimeError, "range %s has too many elements for an array: %d", r.Inspect(), n)
+	}
+	elements := make([]Object, n)
+	for i := range elements {
+		elements[i] = &Integer{Value: r.Start + int64(i)*r.Step}
+	}
+	return elements, nil
+}
+
+// Iter returns an iterator over the elements of the range.
+func (r *Range) Iter() Iterator {
+	var i int64
+	return &Generator{Resume: func() (Object, bool) {
+		value, ok := r.Index(i)
+		if !ok {
+			return nil, false
+		}
+		i++
+		return &Integer{Value: value}, true
+	}}
+}
+
+// Iterable is implemented by values that can be iterated over without
+// being iterators themselves.
+type Iterable interface {
+	Iter() Iterator
+}
+
+// Slice returns the part of an array, string or range selected by
+// left[start:end:step]. Each bound is an Integer, or Null if it was left
+// out; negative bounds count from the end, and a negative step walks
+// backwards, as in Python.
+func Slice(left, start, end, step Object) Object {
+	var n int64
+	switch left := left.(type) {
+	case *Array:
+		n = int64(len(left.Elements))
+	case *String:
+		n = int64(len(left.Value))
+	case *Range:
+		n = left.Len()
+	default:
+		return NewError(TypeError, "slice operator not supported: %s", left.Type())
+	}
+	from, by, count, err := sliceIndices(n, start, end, step)
+	if err != nil {
+		return err
+	}
+
+	switch left := left.(type) {
+	case *Array:
+		elements := make([]Object, count)
+		for i := range elements {
+			elements[i] = left.Elements[from+int64(i)*by]
+		}
+		return &Array{Elements: elements}
+	case *String:
+		if by == 1 {
+			return &String{Value: left.Value[from : from+count]}
+		}
+		bytes := make([]byte, count)
+		for i := range bytes {
+			bytes[i] = left.Value[from+int64(i)*by]
+		}
+		return &String{Value: string(bytes)}
+	default:
+		r := left.(*Range)
+		sliced := &Range{Start: r.Start + from*r.Step, Step: r.Step * by}
+		sliced.End = sliced.Start
+		if count > 0 {
+			// End just past the last element, so it reads naturally.
+			last := sliced.Start + (count-1)*sliced.Step
+			if sliced.Step > 0 {
+				sliced.End = last + 1
+			} else {
+				sliced.End = last - 1
+			}
+		}
+		return sliced
+	}
+}
+
+// sliceIndices works out the first index, step and number of elements of a
+// slice of a sequence of length n.
+func sliceIndices(n int64, start, end, step Object) (int64, int64, int64, *Error) {
+	by := int64(1)
+	if _, ok := step.(*Null); !ok {
+		s, ok := step.(*Integer)
+		if !ok {
+			return 0, 0, 0, NewError(TypeError, "slice step must be INTEGER, got %s", step.Type())
+		}
+		if s.Value == 0 {
+			return 0, 0, 0, NewError(RuntimeError, "slice step cannot be zero")
+		}
+		by = s.Value
+	}
+	lower, upper := int64(0), n
+	if by < 0 {
+		lower, upper = -1, n-1
+	}
+	bound := func(b Object, def int64) (int64, *Error) {
+		if _, ok := b.(*Null); ok {
+			return def, nil
+		}
+		i, ok := b.(*Integer)
+		if !ok {
+			return 0, NewError(TypeError, "slice index must be INTEGER, got %s", b.Type())
+		}
+		v := i.Value
+		if v < 0 {
+			v += n
+		}
+		if v < lower {
+			return lower, nil
+		}
+		if v > upper {
+			return upper, nil
+		}
+		return v, nil
+	}
+	from, to := upper, lower
+	if by > 0 {
+		from, to = lower, upper
+	}
+	from, err := bound(start, from)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	to, err = bound(end, to)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	r := &Range{Start: from, End: to, Step: by}
+	return from, by, r.Len(), nil
+}
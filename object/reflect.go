@@ -0,0 +1,478 @@
+package object
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// FromGo and ToGo convert between Go values and objects, for embedders
+// handing values to scripts and taking them back:
+//
+//	bool                       BOOLEAN
+//	integers                   INTEGER
+//	string                     STRING
+//	slices and arrays          ARRAY
+//	maps and structs           HASH
+//	nil pointers and nil       NULL
+//	funcs                      BUILTIN, from Go only
+//
+// A struct field is the hash key named by its `monkey` tag, or else by the
+// field's name. Fields tagged `monkey:"-"` and unexported ones are left
+// out. Errors name the field, element or key that failed, as in
+// "friends[1].age: cannot convert STRING to int".
+
+var (
+	objectType = reflect.TypeOf((*Object)(nil)).Elem()
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// FromGo converts a Go value to an object. Objects are returned as they
+// are, and a func is wrapped by WrapFunc.
+func FromGo(v interface{}) (Object, error) {
+	return fromGo(reflect.ValueOf(v), "", map[uintptr]bool{})
+}
+
+func fromGo(v reflect.Value, path string, seen map[uintptr]bool) (Object, error) {
+	if !v.IsValid() {
+		return NULL, nil
+	}
+	if v.Type().Implements(objectType) && (v.Kind() != reflect.Ptr || !v.IsNil()) {
+		if obj, ok := v.Interface().(Object); ok {
+			return obj, nil
+		}
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return TRUE, nil
+		}
+		return FALSE, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Integer{Value: v.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > 1<<63-1 {
+			return nil, conversionError(path, "%d overflows INTEGER", v.Uint())
+		}
+		return &Integer{Value: int64(v.Uint())}, nil
+	case reflect.String:
+		return &String{Value: v.String()}, nil
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		if v.Kind() == reflect.Ptr {
+			if seen[v.Pointer()] {
+				return nil, conversionError(path, "cannot convert a %s that contains itself", v.Type())
+			}
+			seen[v.Pointer()] = true
+			defer delete(seen, v.Pointer())
+		}
+		return fromGo(v.Elem(), path, seen)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice {
+			if v.IsNil() {
+				return NULL, nil
+			}
+			if v.Len() > 0 {
+				if seen[v.Pointer()] {
+					return nil, conversionError(path, "cannot convert a %s that contains itself", v.Type())
+				}
+				seen[v.Pointer()] = true
+				defer delete(seen, v.Pointer())
+			}
+		}
+		elements := make([]Object, v.Len())
+		for i := range elements {
+			el, err := fromGo(v.Index(i), fmt.Sprintf("%s[%d]", path, i), seen)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = el
+		}
+		return &Array{Elements: elements}, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		if seen[v.Pointer()] {
+			return nil, conversionError(path, "cannot convert a %s that contains itself", v.Type())
+		}
+		seen[v.Pointer()] = true
+		defer delete(seen, v.Pointer())
+		hash := NewHash()
+		for _, key := range sortedKeys(v) {
+			k, err := fromGo(key, path, seen)
+			if err != nil {
+				return nil, err
+			}
+			hashable, ok := k.(Hashable)
+			if !ok {
+				return nil, conversionError(path, "unusable as hash key: %s", k.Type())
+			}
+			value, err := fromGo(v.MapIndex(key), fmt.Sprintf("%s[%s]", path, k.Inspect()), seen)
+			if err != nil {
+				return nil, err
+			}
+			hash.Set(hashable.HashKey(), HashPair{Key: k, Value: value})
+		}
+		return hash, nil
+	case reflect.Struct:
+		hash := NewHash()
+		for _, f := range structFields(v.Type()) {
+			value, err := fromGo(v.Field(f.index), fieldPath(path, f.key), seen)
+			if err != nil {
+				return nil, err
+			}
+			key := &String{Value: f.key}
+			hash.Set(key.HashKey(), HashPair{Key: key, Value: value})
+		}
+		return hash, nil
+	case reflect.Func:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		name := path
+		if name == "" {
+			name = "function"
+		}
+		return WrapFunc(name, v.Interface())
+	default:
+		return nil, conversionError(path, "cannot convert %s to an object", v.Type())
+	}
+}
+
+// sortedKeys returns the keys of a map in order, so that the hash made of
+// it has its pairs in an order that doesn't change from run to run.
+func sortedKeys(v reflect.Value) []reflect.Value {
+	keys := v.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		switch a.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return a.Int() < b.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return a.Uint() < b.Uint()
+		case reflect.String:
+			return a.String() < b.String()
+		}
+		return fmt.Sprint(a) < fmt.Sprint(b)
+	})
+	return keys
+}
+
+type structField struct {
+	index int
+	key   string
+}
+
+// structFields lists the fields of a struct type that are converted, with
+// their hash keys.
+func structFields(t reflect.Type) []structField {
+	fields := []structField{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		key := f.Tag.Get("monkey")
+		if key == "-" {
+			continue
+		}
+		if key == "" {
+			key = f.Name
+		}
+		fields = append(fields, structField{index: i, key: key})
+	}
+	return fields
+}
+
+func fieldPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// conversionError makes an error about the value at path, if it's not the
+// value converted itself.
+func conversionError(path, format string, a ...interface{}) error {
+	message := fmt.Sprintf(format, a...)
+	if path == "" {
+		return errors.New(message)
+	}
+	return errors.New(path + ": " + message)
+}
+
+// ToGo converts an object into the Go value target points to. A field of a
+// struct is only set if the hash has its key, and other keys are ignored.
+// An interface{} gets the Go value the object stands for: int64, string,
+// bool, nil, []interface{} or map[string]interface{}.
+func ToGo(obj Object, target interface{}) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("ToGo needs a non-nil pointer, got %T", target)
+	}
+	return toGo(obj, v.Elem(), "")
+}
+
+func toGo(obj Object, v reflect.Value, path string) error {
+	if obj == nil {
+		obj = NULL
+	}
+	t := v.Type()
+	anything := t.Kind() == reflect.Interface && t.NumMethod() == 0
+	if !anything && reflect.TypeOf(obj).AssignableTo(t) {
+		v.Set(reflect.ValueOf(obj))
+		return nil
+	}
+	mismatch := func() error {
+		return conversionError(path, "cannot convert %s to %s", obj.Type(), t)
+	}
+	if obj.Type() == NULL_OBJ {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map:
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+		return mismatch()
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		b, ok := obj.(*Boolean)
+		if !ok {
+			return mismatch()
+		}
+		v.SetBool(b.Value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := obj.(*Integer)
+		if !ok {
+			return mismatch()
+		}
+		if v.OverflowInt(i.Value) {
+			return conversionError(path, "%d overflows %s", i.Value, t)
+		}
+		v.SetInt(i.Value)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		i, ok := obj.(*Integer)
+		if !ok {
+			return mismatch()
+		}
+		if i.Value < 0 || v.OverflowUint(uint64(i.Value)) {
+			return conversionError(path, "%d overflows %s", i.Value, t)
+		}
+		v.SetUint(uint64(i.Value))
+	case reflect.String:
+		s, ok := obj.(*String)
+		if !ok {
+			return mismatch()
+		}
+		v.SetString(s.Value)
+	case reflect.Slice, reflect.Array:
+		arr, ok := obj.(*Array)
+		if !ok {
+			return mismatch()
+		}
+		if t.Kind() == reflect.Array && t.Len() != len(arr.Elements) {
+			return conversionError(path, "cannot convert ARRAY of %d elements to %s", len(arr.Elements), t)
+		}
+		elements := v
+		if t.Kind() == reflect.Slice {
+			elements = reflect.MakeSlice(t, len(arr.Elements), len(arr.Elements))
+		}
+		for i, el := range arr.Elements {
+			if err := toGo(el, elements.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		v.Set(elements)
+	case reflect.Map:
+		hash, ok := obj.(*Hash)
+		if !ok {
+			return mismatch()
+		}
+		m := reflect.MakeMapWithSize(t, len(hash.Keys))
+		for _, pair := range hash.Ordered() {
+			key := reflect.New(t.Key()).Elem()
+			if err := toGo(pair.Key, key, path); err != nil {
+				return err
+			}
+			value := reflect.New(t.Elem()).Elem()
+			if err := toGo(pair.Value, value, fmt.Sprintf("%s[%s]", path, pair.Key.Inspect())); err != nil {
+				return err
+			}
+			m.SetMapIndex(key, value)
+		}
+		v.Set(m)
+	case reflect.Struct:
+		hash, ok := obj.(*Hash)
+		if !ok {
+			return mismatch()
+		}
+		for _, f := range structFields(t) {
+			key := &String{Value: f.key}
+			pair, ok := hash.Pairs[key.HashKey()]
+			if !ok {
+				continue
+			}
+			if err := toGo(pair.Value, v.Field(f.index), fieldPath(path, f.key)); err != nil {
+				return err
+			}
+		}
+	case reflect.Ptr:
+		elem := reflect.New(t.Elem())
+		if err := toGo(obj, elem.Elem(), path); err != nil {
+			return err
+		}
+		v.Set(elem)
+	case reflect.Interface:
+		if !anything {
+			return mismatch()
+		}
+		value, err := goValue(obj, path)
+		if err != nil {
+			return err
+		}
+		if value == nil {
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+		v.Set(reflect.ValueOf(value))
+	default:
+		return mismatch()
+	}
+	return nil
+}
+
+// goValue returns the Go value an object stands for, for an interface{}.
+func goValue(obj Object, path string) (interface{}, error) {
+	switch obj := obj.(type) {
+	case *Integer:
+		return obj.Value, nil
+	case *String:
+		return obj.Value, nil
+	case *Boolean:
+		return obj.Value, nil
+	case *Null:
+		return nil, nil
+	case *Array:
+		values := make([]interface{}, len(obj.Elements))
+		for i, el := range obj.Elements {
+			value, err := goValue(el, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return values, nil
+	case *Hash:
+		values := make(map[string]interface{}, len(obj.Keys))
+		for _, pair := range obj.Ordered() {
+			key, ok := pair.Key.(*String)
+			if !ok {
+				return nil, conversionError(path, "cannot convert a HASH with %s keys to map[string]interface {}",
+					pair.Key.Type())
+			}
+			value, err := goValue(pair.Value, fieldPath(path, key.Value))
+			if err != nil {
+				return nil, err
+			}
+			values[key.Value] = value
+		}
+		return values, nil
+	default:
+		return obj, nil
+	}
+}
+
+// WrapFunc makes a builtin called name of a Go func, which can then be
+// registered with a Host. Its arguments are converted with ToGo and its
+// result with FromGo. A func may also return an error last, which is
+// raised as a RuntimeError when it isn't nil.
+func WrapFunc(name string, fn interface{}) (*Builtin, error) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return nil, fmt.Errorf("cannot wrap %T as a builtin: not a func", fn)
+	}
+	t := v.Type()
+	results := t.NumOut()
+	returnsError := results > 0 && t.Out(results-1) == errorType
+	if returnsError {
+		results--
+	}
+	if results > 1 {
+		return nil, fmt.Errorf("cannot wrap %s as a builtin: it returns more than one value", t)
+	}
+
+	params := make([]Param, t.NumIn())
+	for i := range params {
+		in := t.In(i)
+		if t.IsVariadic() && i == len(params)-1 {
+			in = in.Elem()
+		}
+		params[i] = Param{Name: fmt.Sprintf("arg%d", i+1), Types: goTypes(in)}
+	}
+
+	b := &Builtin{
+		Name:     name,
+		Params:   params,
+		Variadic: t.IsVariadic(),
+		Doc:      "Calls a Go function of type " + t.String() + ".",
+	}
+	b.Fn = func(ctx Context, args ...Object) Object {
+		in := make([]reflect.Value, len(args))
+		for i, arg := range args {
+			var argType reflect.Type
+			if t.IsVariadic() && i >= t.NumIn()-1 {
+				argType = t.In(t.NumIn() - 1).Elem()
+			} else {
+				argType = t.In(i)
+			}
+			value := reflect.New(argType).Elem()
+			if err := toGo(arg, value, ""); err != nil {
+				return NewError(TypeError, "argument %d to `%s`: %s", i+1, name, err)
+			}
+			in[i] = value
+		}
+		out := v.Call(in)
+		if returnsError {
+			if err := out[len(out)-1]; !err.IsNil() {
+				return NewError(RuntimeError, "%s", err.Interface())
+			}
+		}
+		if results == 0 {
+			return nil
+		}
+		result, err := fromGo(out[0], "", map[uintptr]bool{})
+		if err != nil {
+			return NewError(TypeError, "result of `%s`: %s", name, err)
+		}
+		return result
+	}
+	return b, nil
+}
+
+// goTypes returns the types of objects that convert to a Go type, or none
+// for any object.
+func goTypes(t reflect.Type) []ObjectType {
+	switch t.Kind() {
+	case reflect.Bool:
+		return []ObjectType{BOOLEAN_OBJ}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return []ObjectType{INTEGER_OBJ}
+	case reflect.String:
+		return []ObjectType{STRING_OBJ}
+	case reflect.Slice, reflect.Array:
+		return []ObjectType{ARRAY_OBJ}
+	case reflect.Map, reflect.Struct:
+		return []ObjectType{HASH_OBJ}
+	case reflect.Ptr:
+		if types := goTypes(t.Elem()); types != nil {
+			return append(types, NULL_OBJ)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package object
+
+import "regexp"
+
+// Regex is a compiled regular expression, made by the regex builtin or by
+// a literal '/pattern/', which the compiler puts in the constant pool. The
+// syntax is that of Go's regexp package.
+type Regex struct {
+	Regexp *regexp.Regexp
+}
+
+func (r *Regex) Type() ObjectType { return REGEX_OBJ }
+func (r *Regex) Inspect() string  { return "/" + r.Regexp.String() + "/" }
+
+// NewRegex compiles pattern, returning an error if it isn't valid.
+func NewRegex(pattern string) Object {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return NewError(RuntimeError, "invalid regex /%s/: %s", pattern, err)
+	}
+	return &Regex{Regexp: re}
+}
+
+func builtinRegex(ctx Context, args ...Object) Object {
+	return NewRegex(args[0].(*String).Value)
+}
+
+// The other regex builtins take the regex first, so they're called as its
+// methods: 're.match(s)'.
+
+func builtinMatch(ctx Context, args ...Object) Object {
+	if args[0].(*Regex).Regexp.MatchString(args[1].(*String).Value) {
+		return TRUE
+	}
+	return FALSE
+}
+
+func builtinFindAll(ctx Context, args ...Object) Object {
+	return stringArray(args[0].(*Regex).Regexp.FindAllString(args[1].(*String).Value, -1))
+}
+
+// builtinCaptures returns the groups of the first match, or null if there
+// is none. A regex with named groups gives a hash of them by name; any
+// other gives an array of the whole match followed by each group. A group
+// that took no part in the match is null.
+func builtinCaptures(ctx Context, args ...Object) Object {
+	re := args[0].(*Regex).Regexp
+	s := args[1].(*String).Value
+	indexes := re.FindStringSubmatchIndex(s)
+	if indexes == nil {
+		return nil
+	}
+	groups := make([]Object, len(indexes)/2)
+	for i := range groups {
+		start, end := indexes[2*i], indexes[2*i+1]
+		if start < 0 {
+			groups[i] = NULL
+			continue
+		}
+		groups[i] = &String{Value: s[start:end]}
+	}
+
+	names := re.SubexpNames()
+	hash := NewHash()
+	for i, name := range names {
+		if name == "" {
+			continue
+		}
+		key := &String{Value: name}
+		hash.Set(key.HashKey(), HashPair{Key: key, Value: groups[i]})
+	}
+	if len(hash.Keys) > 0 {
+		return hash
+	}
+	return &Array{Elements: groups}
+}
+
+// builtinReplaceAll replaces every match with the replacement, in which $1
+// or ${name} stands for a group, or with what a function returns given the
+// matched text.
+func builtinReplaceAll(ctx Context, args ...Object) Object {
+	re := args[0].(*Regex).Regexp
+	s := args[1].(*String).Value
+	if repl, ok := args[2].(*String); ok {
+		return &String{Value: re.ReplaceAllString(s, repl.Value)}
+	}
+
+	var err Object
+	result := re.ReplaceAllStringFunc(s, func(match string) string {
+		if err != nil {
+			return match
+		}
+		replaced := ctx.Call(args[2], &String{Value: match})
+		str, ok := replaced.(*String)
+		if !ok {
+			err = replaced
+			if !isError(replaced) {
+				err = NewError(TypeError, "replacement returned to `replace_all` must be STRING, got %s",
+					replaced.Type())
+			}
+			return match
+		}
+		return str.Value
+	})
+	if err != nil {
+		return err
+	}
+	return &String{Value: result}
+}
+
+func splitRegex(args []Object) Object {
+	return stringArray(args[0].(*Regex).Regexp.Split(args[1].(*String).Value, -1))
+}
@@ -0,0 +1,253 @@
+package object
+
+import (
+	"fmt"
+	"strings"
+
+	"waiacig/token"
+)
+
+// Param is a parameter of a builtin.
+type Param struct {
+	Name string
+	// Types are what the argument can be. Besides the types of values
+	// there are ANY, ITERABLE and ITERATOR.
+	Types []ObjectType
+}
+
+// Parameter types standing for more than one type of value.
+const (
+	ANY      = "any"
+	ITERABLE = "iterable"    // an array, or a value that can be iterated over
+	ITERATOR = "an iterator" // a value next can be called on
+)
+
+// param makes a Param, which takes any value if no types are given.
+func param(name string, types ...ObjectType) Param {
+	if len(types) == 0 {
+		types = []ObjectType{ANY}
+	}
+	return Param{Name: name, Types: types}
+}
+
+// Call checks that args fit b's parameters and then runs b with them.
+func (b *Builtin) Call(ctx Context, args ...Object) Object {
+	if err := b.check(args); err != nil {
+		return err
+	}
+	return b.Fn(ctx, args...)
+}
+
+func (b *Builtin) check(args []Object) *Error {
+	min, max := len(b.Params)-b.Optional, len(b.Params)
+	if b.Variadic {
+		min--
+	}
+	if len(args) < min || len(args) > max && !b.Variadic {
+		return NewError(ArityError, "wrong number of arguments. got=%d, want=%s",
+			len(args), b.arity())
+	}
+	for i, arg := range args {
+		p := b.Params[len(b.Params)-1]
+		if i < len(b.Params) {
+			p = b.Params[i]
+		}
+		if p.accepts(arg) {
+			continue
+		}
+		if i == 0 {
+			return NewError(TypeError, "argument to `%s` must be %s, got %s",
+				b.Name, p.describe(), arg.Type())
+		}
+		return NewError(TypeError, "argument %d to `%s` must be %s, got %s",
+			i+1, b.Name, p.describe(), arg.Type())
+	}
+	return nil
+}
+
+// arity describes how many arguments b takes.
+func (b *Builtin) arity() string {
+	min, max := len(b.Params)-b.Optional, len(b.Params)
+	switch {
+	case b.Variadic:
+		return fmt.Sprintf("at least %d", min-1)
+	case min == max:
+		return fmt.Sprintf("%d", min)
+	case min+1 == max:
+		return fmt.Sprintf("%d or %d", min, max)
+	default:
+		return fmt.Sprintf("%d to %d", min, max)
+	}
+}
+
+func (p Param) accepts(arg Object) bool {
+	if len(p.Types) == 0 {
+		return true
+	}
+	for _, t := range p.Types {
+		switch t {
+		case ANY:
+			return true
+		case ITERABLE:
+			switch arg.(type) {
+			case *Array, Iterable, Iterator:
+				return true
+			}
+		case ITERATOR:
+			if _, ok := arg.(Iterator); ok {
+				return true
+			}
+		default:
+			if arg.Type() == t {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// describe lists the types p accepts: "INTEGER or STRING".
+func (p Param) describe() string {
+	names := make([]string, len(p.Types))
+	for i, t := range p.Types {
+		names[i] = string(t)
+	}
+	if len(names) == 1 {
+		return names[0]
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " or " + names[len(names)-1]
+}
+
+// Signature shows how b is called: "substr(s: STRING, start: INTEGER,
+// length?: INTEGER)". Optional parameters are marked with a question mark
+// and the repeated one of a variadic builtin with an ellipsis.
+func (b *Builtin) Signature() string {
+	params := make([]string, len(b.Params))
+	for i, p := range b.Params {
+		name := p.Name
+		if i >= len(b.Params)-b.Optional {
+			name += "?"
+		}
+		if b.Variadic && i == len(b.Params)-1 {
+			name = "..." + name
+		}
+		if len(p.Types) == 0 || len(p.Types) == 1 && p.Types[0] == ANY {
+			params[i] = name
+			continue
+		}
+		params[i] = name + ": " + p.describe()
+	}
+	return b.Name + "(" + strings.Join(params, ", ") + ")"
+}
+
+// builtinsByName indexes Builtins, and builtinNames lists their names in
+// order. They're filled in by init, as help, one of the Builtins, uses
+// them.
+var (
+	builtinsByName = map[string]*Builtin{}
+	builtinNames   []string
+)
+
+func init() {
+	for _, b := range Builtins {
+		builtinsByName[b.Name] = b
+		builtinNames = append(builtinNames, b.Name)
+	}
+}
+
+func GetBuiltinByName(name string) *Builtin {
+	return builtinsByName[name]
+}
+
+// maxBuiltins is how many builtins, host functions included, OpGetBuiltin
+// can refer to.
+const maxBuiltins = 1 << 16
+
+// Register adds a Go function to the builtins of the interpreters h is the
+// host of, so that scripts can call it by b.Name. Its arguments are checked
+// against b.Params as for any builtin. Functions are registered before
+// scripts are compiled or run, as their index among the builtins is fixed
+// at compile time.
+func (h *Host) Register(b *Builtin) error {
+	if !validName(b.Name) {
+		return fmt.Errorf("cannot register %q: not a valid name", b.Name)
+	}
+	if h.Lookup(b.Name) != nil {
+		return fmt.Errorf("cannot register %s: the name is taken", b.Name)
+	}
+	if b.Fn == nil {
+		return fmt.Errorf("cannot register %s: no function", b.Name)
+	}
+	if len(Builtins)+len(h.functions) >= maxBuiltins {
+		return fmt.Errorf("cannot register %s: too many host functions", b.Name)
+	}
+	h.functions = append(h.functions, b)
+	return nil
+}
+
+// validName reports whether name can be written as an identifier: it's
+// made of ASCII letters and underscores, and isn't a keyword.
+func validName(name string) bool {
+	if name == "" || token.LookupIdent(name) != token.IDENT {
+		return false
+	}
+	for _, r := range name {
+		if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// Builtins returns the builtins of the interpreters h is the host of, in
+// the order of their indexes: those of the language, followed by the
+// functions registered with h. h may be nil.
+func (h *Host) Builtins() []*Builtin {
+	if h == nil {
+		return Builtins
+	}
+	return append(Builtins[:len(Builtins):len(Builtins)], h.functions...)
+}
+
+// Builtin returns the builtin with an index, or nil if there's none.
+func (h *Host) Builtin(index int) *Builtin {
+	if index < len(Builtins) {
+		return Builtins[index]
+	}
+	if h != nil && index-len(Builtins) < len(h.functions) {
+		return h.functions[index-len(Builtins)]
+	}
+	return nil
+}
+
+// Lookup returns the builtin or registered function called name, or nil.
+func (h *Host) Lookup(name string) *Builtin {
+	if b := builtinsByName[name]; b != nil || h == nil {
+		return b
+	}
+	for _, b := range h.functions {
+		if b.Name == name {
+			return b
+		}
+	}
+	return nil
+}
+
+// builtinHelp prints the signature and documentation of a builtin, or the
+// names of all of them when called without one.
+func builtinHelp(ctx Context, args ...Object) Object {
+	if len(args) == 0 {
+		names := builtinNames
+		if host := ctx.Host(); host != nil {
+			for _, b := range host.functions {
+				names = append(names[:len(names):len(names)], b.Name)
+			}
+		}
+		return write(stdoutOf(ctx), strings.Join(names, " ")+"\n")
+	}
+	b := args[0].(*Builtin)
+	if b.Doc == "" {
+		return write(stdoutOf(ctx), b.Signature()+"\n")
+	}
+	return write(stdoutOf(ctx), b.Signature()+"\n"+b.Doc+"\n")
+}
@@ -0,0 +1,209 @@
+package object
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// String positions and lengths count bytes, as len and slicing do; chars
+// is the way to get at the characters of a string.
+
+// maxStringLength is the longest string, in bytes, that repeat will make.
+const maxStringLength = 1 << 30
+
+// builtinSplit splits a string around a separator, or around the matches
+// of a regex given first instead.
+func builtinSplit(ctx Context, args ...Object) Object {
+	if args[0].Type() == REGEX_OBJ {
+		return splitRegex(args)
+	}
+	parts := strings.Split(args[0].(*String).Value, args[1].(*String).Value)
+	return stringArray(parts)
+}
+
+func builtinJoin(ctx Context, args ...Object) Object {
+	elements := args[0].(*Array).Elements
+	parts := make([]string, len(elements))
+	for i, el := range elements {
+		s, ok := el.(*String)
+		if !ok {
+			return NewError(TypeError, "elements joined by `join` must be STRING, got %s", el.Type())
+		}
+		parts[i] = s.Value
+	}
+	return &String{Value: strings.Join(parts, args[1].(*String).Value)}
+}
+
+// stringBuiltin makes a builtin of a function from one string to another.
+func stringBuiltin(fn func(string) string) BuiltinFunction {
+	return func(ctx Context, args ...Object) Object {
+		return &String{Value: fn(args[0].(*String).Value)}
+	}
+}
+
+// stringTest makes a builtin of a test on a string and a second string.
+func stringTest(fn func(string, string) bool) BuiltinFunction {
+	return func(ctx Context, args ...Object) Object {
+		if fn(args[0].(*String).Value, args[1].(*String).Value) {
+			return TRUE
+		}
+		return FALSE
+	}
+}
+
+func trimLeft(s string) string  { return strings.TrimLeftFunc(s, unicode.IsSpace) }
+func trimRight(s string) string { return strings.TrimRightFunc(s, unicode.IsSpace) }
+
+func builtinReplace(ctx Context, args ...Object) Object {
+	s, old := args[0].(*String).Value, args[1].(*String).Value
+	return &String{Value: strings.ReplaceAll(s, old, args[2].(*String).Value)}
+}
+
+// builtinIndexOf returns the position of the first occurrence of a string
+// in another, or -1.
+func builtinIndexOf(ctx Context, args ...Object) Object {
+	index := strings.Index(args[0].(*String).Value, args[1].(*String).Value)
+	return &Integer{Value: int64(index)}
+}
+
+func builtinRepeat(ctx Context, args ...Object) Object {
+	count := args[1].(*Integer).Value
+	if count < 0 {
+		return NewError(RuntimeError, "repeat count must not be negative, got %d", count)
+	}
+	str := args[0].(*String).Value
+	if len(str) > 0 && count > maxStringLength/int64(len(str)) {
+		return NewError(RuntimeError, "repeat result too long: %d times %d bytes", count, len(str))
+	}
+	return &String{Value: strings.Repeat(str, int(count))}
+}
+
+// builtinSubstr returns length bytes of a string from start on, or the
+// rest of it when there's no length. A negative start counts from the end,
+// and the substring stops at the end of the string.
+func builtinSubstr(ctx Context, args ...Object) Object {
+	s := args[0].(*String).Value
+	n := int64(len(s))
+	start := args[1].(*Integer).Value
+	if start < 0 {
+		start += n
+	}
+	start = clamp(start, 0, n)
+	end := n
+	if len(args) == 3 {
+		length := args[2].(*Integer).Value
+		if length < 0 {
+			return NewError(RuntimeError, "substr length must not be negative, got %d", length)
+		}
+		if length < n-start {
+			end = start + length
+		}
+	}
+	return &String{Value: s[start:end]}
+}
+
+func clamp(i, min, max int64) int64 {
+	if i < min {
+		return min
+	}
+	if i > max {
+		return max
+	}
+	return i
+}
+
+func builtinChars(ctx Context, args ...Object) Object {
+	s := args[0].(*String).Value
+	chars := make([]string, 0, utf8.RuneCountInString(s))
+	for _, r := range s {
+		chars = append(chars, string(r))
+	}
+	return stringArray(chars)
+}
+
+func stringArray(values []string) *Array {
+	elements := make([]Object, len(values))
+	for i, v := range values {
+		elements[i] = &String{Value: v}
+	}
+	return &Array{Elements: elements}
+}
+
+// builtinFormat formats its arguments after the format string, which uses
+// the verbs of Go's fmt with their flags, width and precision:
+//
+//	%v  any value, as it's printed
+//	%s  any value, as it's printed
+//	%q  any value, as a double-quoted string
+//	%d  an integer, and %b, %o, %x and %X for other bases
+//	%c  an integer, as the character with that code point
+//	%t  a boolean
+//	%%  a percent sign
+func builtinFormat(ctx Context, args ...Object) Object {
+	values := args[1:]
+
+	var out strings.Builder
+	s := args[0].(*String).Value
+	for {
+		i := strings.IndexByte(s, '%')
+		if i < 0 {
+			out.WriteString(s)
+			break
+		}
+		out.WriteString(s[:i])
+		end := i + 1 + strings.IndexFunc(s[i+1:], isVerb)
+		if end <= i {
+			return NewError(RuntimeError, "format string ends in an incomplete verb: %s", s[i:])
+		}
+		verb, size := utf8.DecodeRuneInString(s[end:])
+		spec := s[i : end+size]
+		s = s[end+size:]
+		if verb == '%' {
+			out.WriteByte('%')
+			continue
+		}
+		if len(values) == 0 {
+			return NewError(ArityError, "format has no argument for %s", spec)
+		}
+		value, err := formatValue(verb, values[0])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&out, spec, value)
+		values = values[1:]
+	}
+	if len(values) > 0 {
+		return NewError(ArityError, "format has %d arguments left over", len(values))
+	}
+	return &String{Value: out.String()}
+}
+
+// isVerb reports whether r ends a format verb: anything but a flag, width
+// or precision does.
+func isVerb(r rune) bool {
+	return !strings.ContainsRune("+-# 0123456789.", r)
+}
+
+// formatValue converts obj into the Go value that verb formats.
+func formatValue(verb rune, obj Object) (interface{}, *Error) {
+	switch verb {
+	case 'v', 's', 'q':
+		if s, ok := obj.(*String); ok {
+			return s.Value, nil
+		}
+		return obj.Inspect(), nil
+	case 'd', 'b', 'o', 'x', 'X', 'c':
+		if i, ok := obj.(*Integer); ok {
+			return i.Value, nil
+		}
+	case 't':
+		if b, ok := obj.(*Boolean); ok {
+			return b.Value, nil
+		}
+	default:
+		return nil, NewError(RuntimeError, "unknown format verb %%%c", verb)
+	}
+	return nil, NewError(TypeError, "format verb %%%c not supported for %s", verb, obj.Type())
+}
@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"regexp"
 	"strconv"
 
 	"waiacig/ast"
@@ -12,8 +13,11 @@ import (
 const (
 	_ int = iota
 	LOWEST
-	EQUALS // == > or <
+	ASSIGN   // x = y
+	PIPELINE // x |> f(y)
+	EQUALS   // == > or <
 	LESSGREATER
+	RANGE   // a..b
 	SUM     // +
 	PRODUCT // *
 	PREFIX  // -X or !X
@@ -31,6 +35,13 @@ type Parser struct {
 	infixParseFns  map[token.TokenType]infixParseFn
 
 	errors []string
+
+	// yields has an entry for each function literal being parsed, set once
+	// its body is found to yield.
+	yields []bool
+	// guard is set while parsing a match arm guard, where '=>' ends the
+	// guard instead of starting a lambda.
+	guard bool
 }
 
 func NewParser(l *lexer.Lexer) *Parser {
@@ -50,9 +61,15 @@ func NewParser(l *lexer.Lexer) *Parser {
 	p.registerPrefixFn(token.IF, p.parseIfExpression)
 	p.registerPrefixFn(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefixFn(token.STRING, p.parseStringLiteral)
+	p.registerPrefixFn(token.REGEX, p.parseRegexLiteral)
 	p.registerPrefixFn(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefixFn(token.LBRACE, p.parseHashLiteral)
 	p.registerPrefixFn(token.MACRO, p.parseMacroLiteral)
+	p.registerPrefixFn(token.MATCH, p.parseMatchExpression)
+	p.registerPrefixFn(token.TRY, p.parseTryExpression)
+	p.registerPrefixFn(token.YIELD, p.parseYieldExpression)
+	p.registerPrefixFn(token.PIPE, p.parseLambda)
+	p.registerPrefixFn(token.IMPORT, p.parseImportExpression)
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.registerInfixFn(token.PLUS, p.parseInfixExpression)
@@ -65,6 +82,10 @@ func NewParser(l *lexer.Lexer) *Parser {
 	p.registerInfixFn(token.GT, p.parseInfixExpression)
 	p.registerInfixFn(token.LPAREN, p.parseCallExpression)
 	p.registerInfixFn(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfixFn(token.PIPELINE, p.parsePipeExpression)
+	p.registerInfixFn(token.DOT, p.parseDotExpression)
+	p.registerInfixFn(token.RANGE, p.parseRangeExpression)
+	p.registerInfixFn(token.ASSIGN, p.parseAssignExpression)
 
 	// to set curToken and peekToken
 
@@ -80,7 +101,28 @@ func (p *Parser) parseMacroLiteral() ast.Expression {
 		return nil
 	}
 
-	lit.Parameters = p.parseFunctionParameters()
+	params := &ast.FunctionLiteral{}
+	if !p.parseFunctionParameters(params, token.RPAREN) {
+		return nil
+	}
+	for i, pattern := range params.Patterns {
+		if pattern != nil {
+			msg := fmt.Sprintf("macro parameters can't be destructured, got %s", pattern)
+			p.errors = append(p.errors, msg)
+			return nil
+		}
+		if params.Defaults[i] != nil {
+			msg := fmt.Sprintf("macro parameters can't have defaults, got %s", params.Parameters[i])
+			p.errors = append(p.errors, msg)
+			return nil
+		}
+	}
+	if params.Rest != nil {
+		msg := fmt.Sprintf("macro parameters can't be variadic, got ...%s", params.Rest)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+	lit.Parameters = params.Parameters
 
 	if !p.expectPeek(token.LBRACE) {
 		return nil
@@ -96,18 +138,94 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	if !p.expectPeek(token.LPAREN) {
 		return nil
 	}
-	lit.Parameters = p.parseFunctionParameters()
+	if !p.parseFunctionParameters(lit, token.RPAREN) {
+		return nil
+	}
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
+	p.yields = append(p.yields, false)
 	lit.Body = p.parseBlockStatement()
+	lit.IsGenerator = p.yields[len(p.yields)-1]
+	p.yields = p.yields[:len(p.yields)-1]
 	return lit
 }
 
+// parseLambda parses the short function forms '|x, y| body' and 'x => body'
+// into an ordinary function literal. The body is a single expression, or a
+// block if it starts with '{'.
+func (p *Parser) parseLambda() ast.Expression {
+	lit := &ast.FunctionLiteral{Token: token.Token{Type: token.FUNCTION, Literal: "fn"}}
+	if p.curTokenIs(token.IDENT) {
+		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		lit.Parameters = []*ast.Identifier{ident}
+		lit.Patterns = []ast.Pattern{nil}
+		lit.Defaults = []ast.Expression{nil}
+		p.nextToken()
+	} else if !p.parseFunctionParameters(lit, token.PIPE) {
+		return nil
+	}
+	p.yields = append(p.yields, false)
+	if p.peekTokenIs(token.LBRACE) {
+		p.nextToken()
+		lit.Body = p.parseBlockStatement()
+	} else {
+		tok := p.peekToken
+		p.nextToken()
+		guard := p.guard
+		p.guard = false
+		body := &ast.ExpressionStatement{Token: tok, Expression: p.parseExpression(LOWEST)}
+		p.guard = guard
+		lit.Body = &ast.BlockStatement{Token: tok, Statements: []ast.Statement{body}}
+	}
+	lit.IsGenerator = p.yields[len(p.yields)-1]
+	p.yields = p.yields[:len(p.yields)-1]
+	return lit
+}
+
+func (p *Parser) parseYieldExpression() ast.Expression {
+	expression := &ast.YieldExpression{Token: p.curToken}
+	if len(p.yields) == 0 {
+		p.errors = append(p.errors, "yield outside of a function")
+		return nil
+	}
+	p.yields[len(p.yields)-1] = true
+	if p.peekTokenIs(token.ASTERISK) {
+		p.nextToken()
+		expression.Delegate = true
+	}
+	p.nextToken()
+	expression.Value = p.parseExpression(LOWEST)
+	return expression
+}
+
+func (p *Parser) parseImportExpression() ast.Expression {
+	exp := &ast.ImportExpression{Token: p.curToken}
+	if !p.expectPeek(token.LPAREN) || !p.expectPeek(token.STRING) {
+		return nil
+	}
+	exp.Path = p.curToken.Literal
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	return exp
+}
+
 func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+// parseRegexLiteral checks that the pattern compiles, so that a bad one is
+// reported with the other syntax errors.
+func (p *Parser) parseRegexLiteral() ast.Expression {
+	if _, err := regexp.Compile(p.curToken.Literal); err != nil {
+		msg := fmt.Sprintf("invalid regex /%s/: %s", p.curToken.Literal, err)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+	return &ast.RegexLiteral{Token: p.curToken, Pattern: p.curToken.Literal}
+}
+
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	array := &ast.ArrayLiteral{Token: p.curToken}
 	array.Elements = p.parseExpressionList(token.RBRACKET)
@@ -126,6 +244,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		p.nextToken()
 		value := p.parseExpression(LOWEST)
 		hash.Pairs[key] = value
+		hash.Keys = append(hash.Keys, key)
 		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
 			return nil
 		}
@@ -143,11 +262,11 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 		return list
 	}
 	p.nextToken()
-	list = append(list, p.parseExpression(LOWEST))
+	list = append(list, p.parseListElement())
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
 		p.nextToken()
-		list = append(list, p.parseExpression(LOWEST))
+		list = append(list, p.parseListElement())
 	}
 	if !p.expectPeek(end) {
 		return nil
@@ -155,45 +274,187 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	return list
 }
 
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
-	identifiers := []*ast.Identifier{}
-	if p.peekTokenIs(token.RPAREN) {
-		p.nextToken()
-		return identifiers
+// parseListElement parses an element of an array literal or argument list,
+// which may be spread with a leading '...'.
+func (p *Parser) parseListElement() ast.Expression {
+	if !p.curTokenIs(token.ELLIPSIS) {
+		return p.parseExpression(LOWEST)
 	}
+	spread := &ast.SpreadElement{Token: p.curToken}
 	p.nextToken()
-	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-	identifiers = append(identifiers, ident)
-	for p.peekTokenIs(token.COMMA) {
+	spread.Value = p.parseExpression(LOWEST)
+	return spread
+}
+
+// parseFunctionParameters parses a parameter list into lit. A parameter
+// written as an array or hash pattern gets a placeholder identifier named
+// after the pattern, which can't clash with a real name; the pattern itself
+// is stored at the same position in lit.Patterns. Parameters may have
+// default values, which must come after all required parameters, and the
+// list may end with a '...rest' parameter. The list is closed by end.
+func (p *Parser) parseFunctionParameters(lit *ast.FunctionLiteral, end token.TokenType) bool {
+	lit.Parameters = []*ast.Identifier{}
+	lit.Patterns = []ast.Pattern{}
+	lit.Defaults = []ast.Expression{}
+	if p.peekTokenIs(end) {
 		p.nextToken()
+		return true
+	}
+	for {
+		p.nextToken()
+		if p.curTokenIs(token.ELLIPSIS) {
+			if !p.expectPeek(token.IDENT) {
+				return false
+			}
+			lit.Rest = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			if p.peekTokenIs(token.COMMA) {
+				msg := fmt.Sprintf("rest parameter ...%s must be last", lit.Rest)
+				p.errors = append(p.errors, msg)
+				return false
+			}
+			break
+		}
+		var ident *ast.Identifier
+		var pattern ast.Pattern
+		switch p.curToken.Type {
+		case token.LBRACKET, token.LBRACE:
+			tok := p.curToken
+			pattern = p.parsePattern()
+			if pattern == nil {
+				return false
+			}
+			ident = &ast.Identifier{Token: tok, Value: pattern.String()}
+		default:
+			ident = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		}
+		var def ast.Expression
+		if p.peekTokenIs(token.ASSIGN) {
+			p.nextToken()
+			p.nextToken()
+			def = p.parseExpression(LOWEST)
+		} else if n := len(lit.Defaults); n > 0 && lit.Defaults[n-1] != nil {
+			msg := fmt.Sprintf("parameter %s without default follows parameter with default", ident)
+			p.errors = append(p.errors, msg)
+			return false
+		}
+		lit.Parameters = append(lit.Parameters, ident)
+		lit.Patterns = append(lit.Patterns, pattern)
+		lit.Defaults = append(lit.Defaults, def)
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
 		p.nextToken()
-		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-		identifiers = append(identifiers, ident)
 	}
-	if !p.expectPeek(token.RPAREN) {
+	if !p.expectPeek(end) {
+		return false
+	}
+	return p.checkDefaults(lit)
+}
+
+// checkDefaults rejects a default that refers to its own parameter or a
+// later one with a default, which may not be bound yet when it's evaluated.
+func (p *Parser) checkDefaults(lit *ast.FunctionLiteral) bool {
+	for i, def := range lit.Defaults {
+		if def == nil {
+			continue
+		}
+		unbound := map[string]bool{}
+		for j := i; j < len(lit.Parameters); j++ {
+			unbound[lit.Parameters[j].Value] = true
+		}
+		ok := true
+		ast.Modify(def, func(node ast.Node) ast.Node {
+			if ident, isIdent := node.(*ast.Identifier); isIdent && unbound[ident.Value] && ok {
+				msg := fmt.Sprintf("default for parameter %s refers to parameter %s",
+					lit.Parameters[i], ident)
+				p.errors = append(p.errors, msg)
+				ok = false
+			}
+			return node
+		})
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// parsePipeExpression desugars 'x |> f(y)' to 'f(x, y)', and 'x |> f' to
+// 'f(x)'.
+func (p *Parser) parsePipeExpression(left ast.Expression) ast.Expression {
+	tok := p.curToken
+	precedence := p.curPrecedence()
+	p.nextToken()
+	right := p.parseExpression(precedence)
+	if right == nil {
 		return nil
 	}
-	return identifiers
+	if call, ok := right.(*ast.CallExpression); ok {
+		call.Arguments = append([]ast.Expression{left}, call.Arguments...)
+		return call
+	}
+	return &ast.CallExpression{Token: tok, Function: right, Arguments: []ast.Expression{left}}
+}
+
+// parseDotExpression parses 'obj.field', which is sugar for 'obj["field"]',
+// and the method call 'obj.name(args)'.
+func (p *Parser) parseDotExpression(left ast.Expression) ast.Expression {
+	tok := p.curToken
+	// Keywords are names too after a dot, as in 're.match(s)'.
+	if token.LookupIdent(p.peekToken.Literal) != p.peekToken.Type {
+		p.peekError(token.IDENT)
+		return nil
+	}
+	p.nextToken()
+	name := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	if p.peekTokenIs(token.LPAREN) {
+		p.nextToken()
+		method := &ast.MethodExpression{Token: tok, Object: left, Name: name}
+		return p.parseCallExpression(method)
+	}
+	index := &ast.StringLiteral{Token: p.curToken, Value: name.Value}
+	return &ast.IndexExpression{Token: tok, Left: left, Index: index}
 }
 
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: p.curToken, Function: function}
-	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	exp.Arguments = p.parseCallArguments()
 	return exp
 }
 
+// parseCallArguments parses an argument list. Besides the elements of an
+// expression list, it accepts keyword arguments written 'name: value',
+// which must come after all positional and spread arguments.
 func (p *Parser) parseCallArguments() []ast.Expression {
 	args := []ast.Expression{}
 	if p.peekTokenIs(token.RPAREN) {
 		p.nextToken()
 		return args
 	}
-	p.nextToken()
-	args = append(args, p.parseExpression(LOWEST))
-	for p.peekTokenIs(token.COMMA) {
+	keywords := false
+	for {
 		p.nextToken()
+		if p.curTokenIs(token.IDENT) && p.peekTokenIs(token.COLON) {
+			arg := &ast.KeywordArgument{Token: p.curToken}
+			arg.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			p.nextToken()
+			p.nextToken()
+			arg.Value = p.parseExpression(LOWEST)
+			args = append(args, arg)
+			keywords = true
+		} else {
+			arg := p.parseListElement()
+			if keywords {
+				msg := fmt.Sprintf("positional argument %s follows keyword argument", arg)
+				p.errors = append(p.errors, msg)
+				return nil
+			}
+			args = append(args, arg)
+		}
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
 		p.nextToken()
-		args = append(args, p.parseExpression(LOWEST))
 	}
 	if !p.expectPeek(token.RPAREN) {
 		return nil
@@ -227,16 +488,243 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return expression
 }
 
+// parseMatchExpression parses 'match (subject) { arms }', or a call of the
+// match builtin, as in 'match(s, re)', when no arms follow a single subject.
+func (p *Parser) parseMatchExpression() ast.Expression {
+	exp := &ast.MatchExpression{Token: p.curToken}
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	lparen := p.curToken
+	args := p.parseCallArguments()
+	if args == nil {
+		return nil
+	}
+	if len(args) != 1 || !p.peekTokenIs(token.LBRACE) {
+		function := &ast.Identifier{Token: exp.Token, Value: exp.Token.Literal}
+		return &ast.CallExpression{Token: lparen, Function: function, Arguments: args}
+	}
+	exp.Subject = args[0]
+	switch exp.Subject.(type) {
+	case *ast.SpreadElement, *ast.KeywordArgument:
+		p.errors = append(p.errors, fmt.Sprintf("invalid match subject %s", exp.Subject))
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		arm := p.parseMatchArm()
+		if arm == nil {
+			return nil
+		}
+		exp.Arms = append(exp.Arms, arm)
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	return exp
+}
+
+func (p *Parser) parseMatchArm() *ast.MatchArm {
+	arm := &ast.MatchArm{Pattern: p.parsePattern()}
+	if arm.Pattern == nil {
+		return nil
+	}
+	if p.peekTokenIs(token.IF) {
+		p.nextToken()
+		p.nextToken()
+		p.guard = true
+		arm.Guard = p.parseExpression(LOWEST)
+		p.guard = false
+	}
+	if !p.expectPeek(token.ARROW) {
+		return nil
+	}
+	p.nextToken()
+	arm.Body = p.parseExpression(LOWEST)
+	return arm
+}
+
+func (p *Parser) parsePattern() ast.Pattern {
+	switch p.curToken.Type {
+	case token.IDENT:
+		return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	case token.INT:
+		lit, ok := p.parseIntegerLiteral().(*ast.IntegerLiteral)
+		if !ok {
+			return nil
+		}
+		return lit
+	case token.MINUS:
+		if !p.expectPeek(token.INT) {
+			return nil
+		}
+		lit, ok := p.parseIntegerLiteral().(*ast.IntegerLiteral)
+		if !ok {
+			return nil
+		}
+		lit.Token.Literal = "-" + lit.Token.Literal
+		lit.Value = -lit.Value
+		return lit
+	case token.STRING:
+		return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+	case token.TRUE, token.FALSE:
+		return &ast.Boolean{Token: p.curToken, Value: p.curTokenIs(token.TRUE)}
+	case token.LBRACKET:
+		return p.parseArrayPattern()
+	case token.LBRACE:
+		return p.parseHashPattern()
+	default:
+		msg := fmt.Sprintf("unexpected %s in pattern", p.curToken.Type)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+}
+
+func (p *Parser) parseArrayPattern() ast.Pattern {
+	pattern := &ast.ArrayPattern{Token: p.curToken}
+	for !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		if p.curTokenIs(token.ELLIPSIS) {
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			pattern.Rest = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			break
+		}
+		element := p.parsePattern()
+		if element == nil {
+			return nil
+		}
+		pattern.Elements = append(pattern.Elements, element)
+		if !p.peekTokenIs(token.RBRACKET) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+	return pattern
+}
+
+func (p *Parser) parseHashPattern() ast.Pattern {
+	pattern := &ast.HashPattern{Token: p.curToken}
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		if p.curTokenIs(token.IDENT) &&
+			(p.peekTokenIs(token.COMMA) || p.peekTokenIs(token.RBRACE)) {
+			// {name} is short for {"name": name}
+			name := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			key := &ast.StringLiteral{
+				Token: token.Token{Type: token.STRING, Literal: name.Value},
+				Value: name.Value,
+			}
+			pattern.Keys = append(pattern.Keys, key)
+			pattern.Values = append(pattern.Values, name)
+			if p.peekTokenIs(token.COMMA) {
+				p.nextToken()
+			}
+			continue
+		}
+		var key ast.Expression
+		switch k := p.parsePattern().(type) {
+		case nil:
+			return nil
+		case *ast.IntegerLiteral, *ast.StringLiteral, *ast.Boolean:
+			key = k.(ast.Expression)
+		default:
+			msg := fmt.Sprintf("hash pattern key must be a literal, got %s", k)
+			p.errors = append(p.errors, msg)
+			return nil
+		}
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+		p.nextToken()
+		value := p.parsePattern()
+		if value == nil {
+			return nil
+		}
+		pattern.Keys = append(pattern.Keys, key)
+		pattern.Values = append(pattern.Values, value)
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	return pattern
+}
+
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
+	if p.peekTokenIs(token.COLON) {
+		return p.parseSliceExpression(exp)
+	}
 	p.nextToken()
 	exp.Index = p.parseExpression(LOWEST)
+	if p.peekTokenIs(token.COLON) {
+		return p.parseSliceExpression(exp)
+	}
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+	return exp
+}
+
+// parseSliceExpression parses the rest of 'left[start:end:step]' once the
+// index expression has been read up to the first ':'. Any of the bounds
+// may be left out.
+func (p *Parser) parseSliceExpression(index *ast.IndexExpression) ast.Expression {
+	exp := &ast.SliceExpression{Token: index.Token, Left: index.Left, Start: index.Index}
+	p.nextToken()
+	if !p.peekTokenIs(token.COLON) && !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		exp.End = p.parseExpression(LOWEST)
+	}
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		if !p.peekTokenIs(token.RBRACKET) {
+			p.nextToken()
+			exp.Step = p.parseExpression(LOWEST)
+		}
+	}
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
 	}
 	return exp
 }
 
+// parseAssignExpression parses 'target = value'. Assignment is right
+// associative, so 'a = b = c' assigns c to both.
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	exp := &ast.AssignExpression{Token: p.curToken, Target: target}
+	switch target.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+	default:
+		msg := fmt.Sprintf("cannot assign to %s", target)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+	p.nextToken()
+	exp.Value = p.parseExpression(LOWEST)
+	return exp
+}
+
+func (p *Parser) parseRangeExpression(start ast.Expression) ast.Expression {
+	exp := &ast.RangeExpression{Token: p.curToken, Start: start}
+	precedence := p.curPrecedence()
+	p.nextToken()
+	exp.End = p.parseExpression(precedence)
+	return exp
+}
+
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.curToken}
 	block.Statements = []ast.Statement{}
@@ -286,6 +774,9 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 }
 
 func (p *Parser) parseIdentifier() ast.Expression {
+	if p.peekTokenIs(token.ARROW) && !p.guard {
+		return p.parseLambda()
+	}
 	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 }
 
@@ -323,21 +814,61 @@ func (p *Parser) ParseProgram() *ast.Program {
 
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
-	case token.LET:
+	case token.LET, token.CONST:
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
+	case token.IMPORT:
+		if p.peekTokenIs(token.STRING) {
+			return p.parseImportStatement()
+		}
+		return p.parseExpressionStatement()
+	case token.FUNCTION:
+		if p.peekTokenIs(token.IDENT) {
+			return p.parseFunctionStatement()
+		}
+		return p.parseExpressionStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
 }
 
-func (p *Parser) parseLetStatement() *ast.LetStatement {
-	statement := &ast.LetStatement{Token: p.curToken}
-	if !p.expectPeek(token.IDENT) {
+// parseFunctionStatement parses a function declaration, fn name(params) {}.
+func (p *Parser) parseFunctionStatement() ast.Statement {
+	statement := &ast.FunctionStatement{Token: p.curToken}
+	p.nextToken()
+	statement.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	lit, ok := p.parseFunctionLiteral().(*ast.FunctionLiteral)
+	if !ok {
 		return nil
 	}
-	statement.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	lit.Token = statement.Token
+	lit.Name = statement.Name.Value
+	statement.Function = lit
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return statement
+}
+
+// parseLetStatement parses a let or const statement. A const binds a
+// single name.
+func (p *Parser) parseLetStatement() *ast.LetStatement {
+	statement := &ast.LetStatement{Token: p.curToken, Const: p.curTokenIs(token.CONST)}
+	if !statement.Const && (p.peekTokenIs(token.LBRACKET) || p.peekTokenIs(token.LBRACE)) {
+		p.nextToken()
+		statement.Pattern = p.parsePattern()
+		if statement.Pattern == nil {
+			return nil
+		}
+	} else {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		statement.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
 	}
@@ -350,6 +881,32 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	return statement
 }
 
+// parseImportStatement parses 'import "path" as name', which binds the
+// module like 'let name = import("path")'.
+func (p *Parser) parseImportStatement() ast.Statement {
+	statement := &ast.LetStatement{Token: token.Token{Type: token.LET, Literal: "let"}}
+	exp := &ast.ImportExpression{Token: p.curToken}
+	p.nextToken()
+	exp.Path = p.curToken.Literal
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	if p.curToken.Literal != "as" {
+		msg := fmt.Sprintf("expected as after import path, got %s", p.curToken.Literal)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	statement.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	statement.Value = exp
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return statement
+}
+
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	statement := &ast.ReturnStatement{Token: p.curToken}
 	p.nextToken()
@@ -361,6 +918,54 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return statement
 }
 
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	statement := &ast.ThrowStatement{Token: p.curToken}
+	p.nextToken()
+	statement.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return statement
+}
+
+func (p *Parser) parseTryExpression() ast.Expression {
+	expression := &ast.TryExpression{Token: p.curToken}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	expression.Block = p.parseBlockStatement()
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+		if p.peekTokenIs(token.LPAREN) {
+			p.nextToken()
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			expression.Param = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			if !p.expectPeek(token.RPAREN) {
+				return nil
+			}
+		}
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		expression.Catch = p.parseBlockStatement()
+	}
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		expression.Finally = p.parseBlockStatement()
+	}
+	if expression.Catch == nil && expression.Finally == nil {
+		p.errors = append(p.errors, "try without catch or finally")
+		return nil
+	}
+	return expression
+}
+
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	defer untrace(trace("parseExpressionStatement"))
 	statement := &ast.ExpressionStatement{Token: p.curToken}
@@ -442,16 +1047,20 @@ func (p *Parser) noPrefixParseFnError(t token.TokenType) {
 }
 
 var precedences = map[token.TokenType]int{
+	token.ASSIGN:   ASSIGN,
+	token.PIPELINE: PIPELINE,
 	token.EQ:       EQUALS,
 	token.NOT_EQ:   EQUALS,
 	token.LT:       LESSGREATER,
 	token.GT:       LESSGREATER,
+	token.RANGE:    RANGE,
 	token.PLUS:     SUM,
 	token.MINUS:    SUM,
 	token.SLASH:    PRODUCT,
 	token.ASTERISK: PRODUCT,
 	token.LPAREN:   CALL,
 	token.LBRACKET: INDEX,
+	token.DOT:      INDEX,
 }
 
 func (p *Parser) peekPrecedence() int {
@@ -349,6 +349,62 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"a + b |> f(c) |> g",
+			"g(f((a + b), c))",
+		},
+		{
+			"xs |> map(|x| x * 2)",
+			"map(xs, fn(x) (x * 2))",
+		},
+		{
+			"xs |> map(x => x + 1)",
+			"map(xs, fn(x) (x + 1))",
+		},
+		{
+			"x => y => x + y",
+			"fn(x) fn(y) (x + y)",
+		},
+		{
+			"|a, b = 2| { a * b }",
+			"fn(a, b = 2) (a * b)",
+		},
+		{
+			"|| 1",
+			"fn() 1",
+		},
+		{
+			"a.b.c + d",
+			"(((a[b])[c]) + d)",
+		},
+		{
+			"a.b(c).d(e * f)",
+			"a.b(c).d((e * f))",
+		},
+		{
+			"-a.len()",
+			"(-a.len())",
+		},
+		{
+			"a[1:2] + a[:b] + a[c + 1:] + a[::-1] + a[:]",
+			"(((((a[1:2]) + (a[:b])) + (a[(c + 1):])) + (a[::(-1)])) + (a[:]))",
+		},
+		{
+			"0..n + 1 == r",
+			"((0..(n + 1)) == r)",
+		},
+		{
+			"(0..10)[::2]",
+			"((0..10)[::2])",
+		},
+		{
+			"a = b = c + 1",
+			"(a = (b = (c + 1)))",
+		},
+		{
+			"h.k = xs[0] |> f()",
+			"((h[k]) = f((xs[0])))",
+		},
 	}
 
 	for _, tt := range tests {
@@ -904,6 +960,9 @@ func TestParsingHashLiteralsStringKeys(t *testing.T) {
 		expectedValue := expected[literal.String()]
 		testIntegerLiteral(t, value, expectedValue)
 	}
+	if hash.String() != "{one:1, two:2, three:3}" {
+		t.Errorf("hash.String() not in source order. got=%q", hash.String())
+	}
 }
 
 func TestParsingEmptyHashLiteral(t *testing.T) {
@@ -968,3 +1027,323 @@ func TestMacroLiteralParsing(t *testing.T) {
 
 	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
 }
+
+func TestMatchExpressionParsing(t *testing.T) {
+	input := `match (x) { 1 => "one", [a, ...rest] if a > 1 => a, {"k": v} => v, _ => 0 }`
+
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.MatchExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MatchExpression. got=%T",
+			stmt.Expression)
+	}
+	if !testIdentifier(t, exp.Subject, "x") {
+		return
+	}
+	if len(exp.Arms) != 4 {
+		t.Fatalf("match has wrong number of arms. want=4, got=%d", len(exp.Arms))
+	}
+
+	testIntegerLiteral(t, exp.Arms[0].Pattern.(ast.Expression), 1)
+
+	array, ok := exp.Arms[1].Pattern.(*ast.ArrayPattern)
+	if !ok {
+		t.Fatalf("arm pattern is not ast.ArrayPattern. got=%T", exp.Arms[1].Pattern)
+	}
+	if len(array.Elements) != 1 || array.Rest == nil || array.Rest.Value != "rest" {
+		t.Errorf("array pattern wrong. got=%s", array)
+	}
+	testInfixExpression(t, exp.Arms[1].Guard, "a", ">", 1)
+
+	hash, ok := exp.Arms[2].Pattern.(*ast.HashPattern)
+	if !ok {
+		t.Fatalf("arm pattern is not ast.HashPattern. got=%T", exp.Arms[2].Pattern)
+	}
+	if len(hash.Keys) != 1 || hash.Keys[0].String() != "k" {
+		t.Errorf("hash pattern wrong. got=%s", hash)
+	}
+
+	expected := `match (x) { 1 => one, [a, ...rest] if (a > 1) => a, {k: v} => v, _ => 0 }`
+	if exp.String() != expected {
+		t.Errorf("exp.String() wrong. want=%q, got=%q", expected, exp.String())
+	}
+}
+
+func TestMatchCallParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`match("foo1", /\d/)`, `match(foo1, /\d/)`},
+		{`match(s)`, `match(s)`},
+		{`!match(re, s)`, `(!match(re, s))`},
+		{`if (match(re, s)) { 1 }`, `ifmatch(re, s) 1`},
+	}
+	for _, tt := range tests {
+		p := NewParser(lexer.NewLexer(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestDestructuringParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let [a, ...b] = x;`, `let [a, ...b] = x;`},
+		{`let {"k": v, name} = x;`, `let {k: v, name: name} = x;`},
+		{`fn([a, b], c) { a }`, `fn([a, b], c) a`},
+	}
+	for _, tt := range tests {
+		l := lexer.NewLexer(tt.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("program.String() wrong. want=%q, got=%q",
+				tt.expected, program.String())
+		}
+	}
+
+	l := lexer.NewLexer(`fn([a, b], c) { a }`)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	fn := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if len(fn.Patterns) != 2 || fn.Patterns[1] != nil {
+		t.Fatalf("wrong parameter patterns. got=%v", fn.Patterns)
+	}
+	if _, ok := fn.Patterns[0].(*ast.ArrayPattern); !ok {
+		t.Fatalf("parameter pattern is not ast.ArrayPattern. got=%T", fn.Patterns[0])
+	}
+}
+
+func TestDefaultsRestAndCallArgumentsParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`fn(a, b = 2, ...rest) { a }`, `fn(a, b = 2, ...rest) a`},
+		{`fn(...xs) { xs }`, `fn(...xs) xs`},
+		{`f(a, ...b, c: 1 + 2)`, `f(a, ...b, c: (1 + 2))`},
+		{`[0, ...xs]`, `[0, ...xs]`},
+	}
+	for _, tt := range tests {
+		l := lexer.NewLexer(tt.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("program.String() wrong. want=%q, got=%q",
+				tt.expected, program.String())
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{`fn(a = 1, b) { a }`, "parameter b without default follows parameter with default"},
+		{`fn(...a, b) { a }`, "rest parameter ...a must be last"},
+		{`f(a: 1, b)`, "positional argument b follows keyword argument"},
+		{`fn(a = b, b = 1) { a }`, "default for parameter a refers to parameter b"},
+		{`macro(a = 1) { a }`, "macro parameters can't have defaults, got a"},
+	}
+	for _, tt := range errorTests {
+		l := lexer.NewLexer(tt.input)
+		p := NewParser(l)
+		p.ParseProgram()
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong parser errors for %q. want=%q, got=%v",
+				tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestTryExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`try { x } catch (e) { e }`, `try x catch (e) e`},
+		{`try { x } catch { 1 } finally { y }`, `try x catch 1 finally y`},
+		{`try { x } finally { y }`, `try x finally y`},
+		{`throw x + 1;`, `throw (x + 1);`},
+	}
+	for _, tt := range tests {
+		l := lexer.NewLexer(tt.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("program.String() wrong. want=%q, got=%q",
+				tt.expected, program.String())
+		}
+	}
+
+	l := lexer.NewLexer(`try { x }`)
+	p := NewParser(l)
+	p.ParseProgram()
+	errors := p.Errors()
+	if len(errors) == 0 || errors[0] != "try without catch or finally" {
+		t.Errorf("wrong parser errors. got=%v", errors)
+	}
+}
+
+func TestYieldParsing(t *testing.T) {
+	l := lexer.NewLexer(`fn() { yield 1; fn() { 2 } }; fn() { yield* xs }`)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	expected := []string{`fn() yield 1fn() 2`, `fn() yield* xs`}
+	for i, want := range expected {
+		stmt := program.Statements[i].(*ast.ExpressionStatement)
+		fn, ok := stmt.Expression.(*ast.FunctionLiteral)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.FunctionLiteral. got=%T", stmt.Expression)
+		}
+		if !fn.IsGenerator {
+			t.Errorf("function %d is not a generator", i)
+		}
+		if fn.String() != want {
+			t.Errorf("fn.String() wrong. want=%q, got=%q", want, fn.String())
+		}
+		if i == 0 {
+			inner := fn.Body.Statements[1].(*ast.ExpressionStatement).Expression
+			if inner.(*ast.FunctionLiteral).IsGenerator {
+				t.Errorf("nested function without yield is a generator")
+			}
+		}
+	}
+
+	l = lexer.NewLexer(`yield 1`)
+	p = NewParser(l)
+	p.ParseProgram()
+	errors := p.Errors()
+	if len(errors) == 0 || errors[0] != "yield outside of a function" {
+		t.Errorf("wrong parser errors. got=%v", errors)
+	}
+}
+
+func TestImportParsing(t *testing.T) {
+	l := lexer.NewLexer(`import "lib/strings.mk" as s; let t = import("t.mk"); s.upper(t)`)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	expected := `let s = import("lib/strings.mk");let t = import("t.mk");s.upper(t)`
+	if program.String() != expected {
+		t.Errorf("program.String() wrong. want=%q, got=%q", expected, program.String())
+	}
+
+	l = lexer.NewLexer(`import "lib/strings.mk" s`)
+	p = NewParser(l)
+	p.ParseProgram()
+	errors := p.Errors()
+	if len(errors) == 0 || errors[0] != "expected as after import path, got s" {
+		t.Errorf("wrong parser errors. got=%v", errors)
+	}
+}
+
+func TestConstAndAssignmentParsing(t *testing.T) {
+	l := lexer.NewLexer(`const limit = 10;`)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	stmt, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok || !stmt.Const {
+		t.Fatalf("statement is not a const binding. got=%T (%+v)", program.Statements[0], program.Statements[0])
+	}
+	if program.String() != "const limit = 10;" {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"f() = 1", "cannot assign to f()"},
+		{"const [a, b] = xs", "expected next toke to be IDENT, got [ instead"},
+	}
+	for _, tt := range tests {
+		p := NewParser(lexer.NewLexer(tt.input))
+		p.ParseProgram()
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong parser errors for %q. got=%v", tt.input, errors)
+		}
+	}
+}
+
+func TestFunctionStatementParsing(t *testing.T) {
+	l := lexer.NewLexer(`fn add(a, b = 1) { a + b }; fn(x) { x }(2);`)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.FunctionStatement)
+	if !ok {
+		t.Fatalf("statement is not ast.FunctionStatement. got=%T", program.Statements[0])
+	}
+	if stmt.Name.Value != "add" || stmt.Function.Name != "add" {
+		t.Errorf("wrong function name. got=%q and %q", stmt.Name.Value, stmt.Function.Name)
+	}
+	if len(stmt.Function.Parameters) != 2 {
+		t.Errorf("wrong number of parameters. got=%d", len(stmt.Function.Parameters))
+	}
+	if stmt.String() != "fn add(a, b = 1) (a + b)" {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+	if _, ok := program.Statements[1].(*ast.ExpressionStatement); !ok {
+		t.Errorf("statement is not ast.ExpressionStatement. got=%T", program.Statements[1])
+	}
+}
+
+func TestRegexLiteralParsing(t *testing.T) {
+	l := lexer.NewLexer(`/a(b)*/.match(s)`)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	call, ok := stmt.Expression.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("exp is not ast.CallExpression. got=%T", stmt.Expression)
+	}
+	method, ok := call.Function.(*ast.MethodExpression)
+	if !ok {
+		t.Fatalf("function is not ast.MethodExpression. got=%T", call.Function)
+	}
+	if method.Name.Value != "match" {
+		t.Errorf("wrong method name. got=%q", method.Name.Value)
+	}
+	regex, ok := method.Object.(*ast.RegexLiteral)
+	if !ok {
+		t.Fatalf("object is not ast.RegexLiteral. got=%T", method.Object)
+	}
+	if regex.Pattern != "a(b)*" || regex.String() != "/a(b)*/" {
+		t.Errorf("wrong regex. got=%q", regex.String())
+	}
+
+	p = NewParser(lexer.NewLexer(`/a(/`))
+	p.ParseProgram()
+	errors := p.Errors()
+	if len(errors) != 1 || errors[0] != "invalid regex /a(/: error parsing regexp: missing closing ): `a(`" {
+		t.Errorf("wrong errors. got=%q", errors)
+	}
+}
@@ -5,10 +5,13 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"path/filepath"
+	"strings"
 
 	"waiacig/compiler"
 	"waiacig/evaluator"
 	"waiacig/lexer"
+	"waiacig/module"
 	"waiacig/object"
 	"waiacig/parser"
 	"waiacig/vm"
@@ -31,19 +34,32 @@ const MONKEY_FACE = `
 const PROMPT = ">> "
 
 var vmFlag = flag.Bool("vm", false, "enable vm")
+var pathFlag = flag.String("path", ".", "list of directories to search for imported modules")
+var filesFlag = flag.String("files", "", "directory the file builtins work in; they are off when empty")
 
-func StartREPL(in io.Reader, out io.Writer) {
+// StartREPL reads and runs lines from in until it ends or a script calls
+// exit, returning the exit code.
+func StartREPL(in io.Reader, out io.Writer) int {
 	flag.Parse()
-	scanner := bufio.NewScanner(in)
+	// Scripts read their input with read_line from the same reader.
+	reader := bufio.NewReader(in)
 	constants := []object.Object{}
 	globals := make([]object.Object, vm.GlobalsSize)
-	symbolTable := compiler.NewSymbolTable()
-
-	for i, v := range object.Builtins {
-		symbolTable.DefineBuiltin(i, v.Name)
+	host := &object.Host{Stdout: out, Stdin: reader}
+	if *filesFlag != "" {
+		host.Files = object.DirFS(*filesFlag)
 	}
+	symbolTable := compiler.NewSymbolTable()
+	symbolTable.DefineBuiltins(host)
 
+	loader := module.NewLoader(filepath.SplitList(*pathFlag)...)
+	loader.Host = host
+	// The VM's lines share the modules they import, as they share globals.
+	compiled := compiler.NewModules(loader)
+	imported := vm.Modules{}
 	env := object.NewEnvironment()
+	env.SetImporter(loader)
+	env.SetHost(host)
 	macroEnv := object.NewEnvironment()
 
 	io.WriteString(out, MONKEY_FACE)
@@ -52,11 +68,12 @@ func StartREPL(in io.Reader, out io.Writer) {
 		fmt.Fprintf(out, "using vm!\n")
 	}
 	for {
-		fmt.Printf(PROMPT)
-		if !scanner.Scan() {
-			return
+		io.WriteString(out, PROMPT)
+		line, err := reader.ReadString('\n')
+		if line == "" && err != nil {
+			return 0
 		}
-		line := scanner.Text()
+		line = strings.TrimRight(line, "\r\n")
 		l := lexer.NewLexer(line)
 		p := parser.NewParser(l)
 		program := p.ParseProgram()
@@ -70,15 +87,24 @@ func StartREPL(in io.Reader, out io.Writer) {
 
 		if *vmFlag {
 			comp := compiler.NewCompilerWithState(symbolTable, constants)
+			comp.SetModules(compiled)
+			comp.SetHost(host)
 			err := comp.Compile(program)
+			code := comp.Bytecode()
+			// Modules compiled before an error are reused by later lines,
+			// so the constants they added are kept.
+			constants = code.Constants
 			if err != nil {
 				fmt.Fprintf(out, "Woops! Compilation failed:\n %s\n", err)
 				continue
 			}
-			code := comp.Bytecode()
-			constants = code.Constants
 			machine := vm.NewWithGlobalsStore(code, globals)
+			machine.SetHost(host)
+			machine.SetModules(imported)
 			err = machine.Run()
+			if status, exit := object.ExitCode(err); exit {
+				return status
+			}
 			if err != nil {
 				fmt.Fprintf(out, "Woops! Executing bytecode failed:\n %s\n", err)
 				continue
@@ -86,11 +112,18 @@ func StartREPL(in io.Reader, out io.Writer) {
 			lastPopped := machine.LastPoppedStackElem()
 			io.WriteString(out, lastPopped.Inspect())
 			io.WriteString(out, "\n")
+			continue
 		}
 
 		evaluator.DefineMacros(program, macroEnv)
 		expanded := evaluator.ExpandMacros(program, macroEnv)
-		if evaluated := evaluator.Eval(expanded, env); evaluated != nil {
+		evaluated := evaluator.Eval(expanded, env)
+		if err, ok := evaluated.(*object.Error); ok {
+			if status, exit := object.ExitCode(err); exit {
+				return status
+			}
+		}
+		if evaluated != nil {
 			io.WriteString(out, evaluated.Inspect())
 			io.WriteString(out, "\n")
 		}
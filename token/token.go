@@ -33,6 +33,7 @@ const (
 	IDENT  = "IDENT" // add, foobar, x, y, ...
 	INT    = "INT"
 	STRING = "STRING"
+	REGEX  = "REGEX" // /[a-z]+/
 	// Operators
 	ASSIGN   = "="
 	PLUS     = "+"
@@ -44,8 +45,11 @@ const (
 	GT       = ">"
 	EQ       = "=="
 	NOT_EQ   = "!="
+	PIPE     = "|"
+	PIPELINE = "|>"
 	// Delimiters
 	COMMA     = ","
+	DOT       = "."
 	SEMICOLON = ";"
 	LPAREN    = "("
 	RPAREN    = ")"
@@ -54,6 +58,9 @@ const (
 	LBRACKET  = "["
 	RBRACKET  = "]"
 	COLON     = ":"
+	ARROW     = "=>"
+	ELLIPSIS  = "..."
+	RANGE     = ".."
 	// Keywords
 	// 1343456
 	FUNCTION = "FUNCTION"
@@ -63,18 +70,34 @@ const (
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
-    MACRO = "MACRO"
+	MACRO    = "MACRO"
+	MATCH    = "MATCH"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	FINALLY  = "FINALLY"
+	THROW    = "THROW"
+	YIELD    = "YIELD"
+	IMPORT   = "IMPORT"
+	CONST    = "CONST"
 )
 
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"true":   TRUE,
-	"false":  FALSE,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
-    "macro":  MACRO,
+	"fn":      FUNCTION,
+	"let":     LET,
+	"true":    TRUE,
+	"false":   FALSE,
+	"if":      IF,
+	"else":    ELSE,
+	"return":  RETURN,
+	"macro":   MACRO,
+	"match":   MATCH,
+	"try":     TRY,
+	"catch":   CATCH,
+	"finally": FINALLY,
+	"throw":   THROW,
+	"yield":   YIELD,
+	"import":  IMPORT,
+	"const":   CONST,
 }
 
 func LookupIdent(ident string) TokenType {
@@ -0,0 +1,140 @@
+package vm
+
+import (
+	"waiacig/object"
+)
+
+// spread wraps the array pushed by OpSpread, so that OpArray splices its
+// elements into the array being built instead of nesting it.
+type spread struct {
+	elements []object.Object
+}
+
+func (s *spread) Type() object.ObjectType { return "SPREAD" }
+func (s *spread) Inspect() string         { return "..." }
+
+// keywordArgument is an argument passed by parameter name.
+type keywordArgument struct {
+	name  string
+	value object.Object
+}
+
+func (vm *VM) executeSpread() error {
+	value := vm.pop()
+	switch value := value.(type) {
+	case *object.Array:
+		return vm.push(&spread{elements: value.Elements})
+	case *object.Range:
+		elements, err := value.Elements()
+		if err != nil {
+			return err
+		}
+		return vm.push(&spread{elements: elements})
+	default:
+		return object.NewError(object.TypeError, "cannot spread %s", value.Type())
+	}
+}
+
+// executeApply calls a function with the positional arguments in an array,
+// followed on the stack by numKeywords name and value pairs. A tail call
+// replaces the current frame, as OpTailCall does.
+func (vm *VM) executeApply(numKeywords int, tail bool) error {
+	keywordBase := vm.sp - 2*numKeywords
+	keywords := make([]keywordArgument, numKeywords)
+	for i := range keywords {
+		name := vm.stack[keywordBase+2*i].(*object.String)
+		keywords[i] = keywordArgument{name: name.Value, value: vm.stack[keywordBase+2*i+1]}
+	}
+	args := vm.stack[keywordBase-1].(*object.Array)
+	vm.sp = keywordBase - 1
+	for _, arg := range args.Elements {
+		err := vm.push(arg)
+		if err != nil {
+			return err
+		}
+	}
+	if tail {
+		return vm.executeTailCall(len(args.Elements), keywords)
+	}
+	return vm.executeCall(len(args.Elements), keywords)
+}
+
+// bindArguments arranges the numArgs arguments starting at basePointer, and
+// any keyword arguments, into the parameter slots of fn. Extra arguments to
+// a variadic function are collected into its rest array. Parameters the
+// call doesn't supply are left nil for the function's prologue to fill in
+// with their defaults.
+func (vm *VM) bindArguments(
+	fn *object.CompiledFunction,
+	basePointer int,
+	numArgs int,
+	keywords []keywordArgument,
+) error {
+	numRequired := fn.NumParameters - fn.NumDefaults
+	if numArgs > fn.NumParameters && !fn.Variadic ||
+		numArgs < numRequired && len(keywords) == 0 {
+		return arityError(fn, numArgs)
+	}
+
+	var rest []object.Object
+	if fn.Variadic && numArgs > fn.NumParameters {
+		rest = make([]object.Object, numArgs-fn.NumParameters)
+		copy(rest, vm.stack[basePointer+fn.NumParameters:basePointer+numArgs])
+	}
+	for i := numArgs; i < fn.NumParameters; i++ {
+		vm.stack[basePointer+i] = nil
+	}
+	vm.sp = basePointer + fn.NumParameters
+	if fn.Variadic {
+		if rest == nil {
+			rest = []object.Object{}
+		}
+		vm.stack[vm.sp] = &object.Array{Elements: rest}
+		vm.sp++
+	}
+
+	for _, kw := range keywords {
+		index := -1
+		for i, name := range fn.ParameterNames {
+			if name == kw.name {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			return object.NewError(object.ArityError, "unexpected keyword argument: %s", kw.name)
+		}
+		if vm.stack[basePointer+index] != nil {
+			return object.NewError(object.ArityError, "multiple values for argument: %s", kw.name)
+		}
+		vm.stack[basePointer+index] = kw.value
+	}
+	for i := 0; i < numRequired; i++ {
+		if vm.stack[basePointer+i] == nil {
+			return object.NewError(object.ArityError, "missing argument: %s", fn.ParameterNames[i])
+		}
+	}
+	return nil
+}
+
+func arityError(fn *object.CompiledFunction, got int) error {
+	numRequired := fn.NumParameters - fn.NumDefaults
+	what := "wrong number of arguments"
+	if fn.Name != "" {
+		what += " to " + fn.Name
+	}
+	switch {
+	case fn.Variadic:
+		return object.NewError(object.ArityError,
+			"%s: want=at least %d, got=%d",
+			what, numRequired, got)
+	case fn.NumDefaults > 0:
+		return object.NewError(object.ArityError,
+			"%s: want=%d to %d, got=%d",
+			what, numRequired, fn.NumParameters, got)
+	default:
+		return object.NewError(object.ArityError,
+			"%s: want=%d, got=%d",
+			what, fn.NumParameters, got)
+	}
+}
@@ -0,0 +1,60 @@
+package vm
+
+import "waiacig/object"
+
+// Call applies fn to args on behalf of a builtin, making the VM the
+// builtin's object.Context. The call runs to completion in a nested run of
+// the VM, on frames above a sentinel frame with no instructions, so that
+// the run ends when the callee returns to it. Handlers set up outside the
+// call don't see errors raised inside it: those are returned, and raised
+// again by the builtin's caller.
+func (vm *VM) Call(fn object.Object, args ...object.Object) object.Object {
+	if vm.framesIndex >= MaxFrames {
+		return object.NewError(object.RuntimeError, "stack overflow")
+	}
+	sp, framesIndex, handlers := vm.sp, vm.framesIndex, vm.handlers
+	vm.handlers = nil
+	vm.pushFrame(NewFrame(&object.Closure{Fn: &object.CompiledFunction{}}, vm.sp))
+
+	result, err := vm.call(fn, args)
+	vm.sp, vm.framesIndex, vm.handlers = sp, framesIndex, handlers
+	if err != nil {
+		e, ok := err.(*object.Error)
+		if !ok {
+			e = object.NewError(object.RuntimeError, "%s", err)
+		}
+		return e
+	}
+	return result
+}
+
+// SetHost sets what builtins run by the VM are provided with.
+func (vm *VM) SetHost(host *object.Host) {
+	vm.host = host
+}
+
+func (vm *VM) Host() *object.Host {
+	return vm.host
+}
+
+func (vm *VM) call(fn object.Object, args []object.Object) (object.Object, error) {
+	err := vm.push(fn)
+	if err != nil {
+		return nil, err
+	}
+	for _, arg := range args {
+		err := vm.push(arg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = vm.executeCall(len(args), nil)
+	if err != nil {
+		return nil, err
+	}
+	err = vm.Run()
+	if err != nil {
+		return nil, err
+	}
+	return vm.pop(), nil
+}
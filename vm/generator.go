@@ -0,0 +1,84 @@
+package vm
+
+import "waiacig/object"
+
+// generator runs a generator function in a VM of its own that shares the
+// constants and globals of the VM that called it. Between calls to next,
+// the generator's frame and stack slice stay suspended in that VM.
+type generator struct {
+	vm   *VM
+	done bool
+}
+
+// startGenerator creates the generator for a call to cl, whose arguments
+// have been bound at basePointer, and runs the function's prologue so that
+// bad arguments are reported by the call.
+func (vm *VM) startGenerator(cl *object.Closure, basePointer int) error {
+	frames := make([]*Frame, MaxFrames)
+	frames[0] = NewFrame(&object.Closure{Fn: &object.CompiledFunction{}}, 0)
+	frames[1] = NewFrame(cl, 1)
+	g := &generator{vm: &VM{
+		constants:   vm.constants,
+		stack:       make([]object.Object, StackSize),
+		sp:          1 + cl.Fn.NumLocals,
+		globals:     vm.globals,
+		frames:      frames,
+		framesIndex: 2,
+		modules:     vm.modules,
+		host:        vm.host,
+	}}
+	copy(g.vm.stack, vm.stack[basePointer-1:basePointer+cl.Fn.NumLocals])
+	vm.sp = basePointer - 1
+
+	err := g.vm.Run()
+	if err != nil {
+		return err
+	}
+	return vm.push(&object.Generator{Resume: g.next})
+}
+
+// next runs the generator up to its next yield, returning the value
+// yielded. The generator is done once its function returns or fails.
+func (g *generator) next() (object.Object, bool) {
+	if g.done {
+		return nil, false
+	}
+	g.vm.yielded = nil
+	err := g.vm.Run()
+	if err != nil {
+		g.done = true
+		e, ok := err.(*object.Error)
+		if !ok {
+			e = object.NewError(object.RuntimeError, "%s", err)
+		}
+		return e, true
+	}
+	if g.vm.yielded == nil {
+		g.done = true
+		return nil, false
+	}
+	return g.vm.yielded, true
+}
+
+// executeIterate pushes the next value of the iterator on top of the stack,
+// or pops the exhausted iterator and jumps to pos.
+func (vm *VM) executeIterate(pos int) error {
+	if iterable, ok := vm.stack[vm.sp-1].(object.Iterable); ok {
+		vm.stack[vm.sp-1] = iterable.Iter()
+	}
+	iterator, ok := vm.stack[vm.sp-1].(object.Iterator)
+	if !ok {
+		return object.NewError(object.TypeError, "cannot iterate over %s",
+			vm.stack[vm.sp-1].Type())
+	}
+	value, ok := iterator.Next()
+	if !ok {
+		vm.pop()
+		vm.currentFrame().ip = pos - 1
+		return nil
+	}
+	if err, ok := value.(*object.Error); ok {
+		return err
+	}
+	return vm.push(value)
+}
@@ -0,0 +1,63 @@
+package vm
+
+import (
+	"waiacig/compiler"
+	"waiacig/object"
+)
+
+// Modules holds the modules imported by the VMs that share it, so that the
+// code of each runs once.
+type Modules map[*object.CompiledModule]*object.Module
+
+// SetModules makes the VM share the modules imported by the other VMs given
+// modules, such as those running a REPL's earlier lines.
+func (vm *VM) SetModules(modules Modules) {
+	vm.modules = modules
+}
+
+// unbound is pushed by OpMethod in place of a module's export, which is
+// called without the module that OpMethod leaves as its first argument.
+type unbound struct {
+	fn object.Object
+}
+
+func (u *unbound) Type() object.ObjectType { return "UNBOUND" }
+func (u *unbound) Inspect() string         { return "unbound " + u.fn.Inspect() }
+
+// executeImport pushes the module compiled into the constant at constIndex.
+// The first import of a module runs its code, in a VM with globals of its
+// own; later imports get the same module.
+func (vm *VM) executeImport(constIndex int) error {
+	cm := vm.constants[constIndex].(*object.CompiledModule)
+	if module, ok := vm.modules[cm]; ok {
+		return vm.push(module)
+	}
+	bytecode := &compiler.Bytecode{
+		Instructions: cm.Instructions,
+		Constants:    vm.constants,
+		NumLocals:    cm.NumLocals,
+	}
+	machine := NewWithGlobalsStore(bytecode, make([]object.Object, cm.NumGlobals))
+	machine.modules = vm.modules
+	machine.host = vm.host
+	err := machine.Run()
+	if err != nil {
+		return err
+	}
+	module := &object.Module{Name: cm.Name, Exports: map[string]object.Object{}}
+	for name, index := range cm.Exports {
+		module.Exports[name] = machine.globals[index]
+	}
+	vm.modules[cm] = module
+	return vm.push(module)
+}
+
+// callUnbound calls a module's export with the numArgs arguments after the
+// module on the stack.
+func (vm *VM) callUnbound(u *unbound, numArgs int, keywords []keywordArgument) error {
+	callee := vm.sp - 1 - numArgs
+	copy(vm.stack[callee+1:], vm.stack[callee+2:vm.sp])
+	vm.sp--
+	vm.stack[callee] = u.fn
+	return vm.executeCall(numArgs-1, keywords)
+}
@@ -0,0 +1,45 @@
+package vm
+
+import "waiacig/object"
+
+// handler is set up by OpTry to catch errors raised before the matching
+// OpEndTry, including those raised in functions called meanwhile.
+type handler struct {
+	framesIndex int // frames above this were called from inside the try
+	catchIP     int
+	sp          int
+}
+
+// catch hands err to the innermost handler, unwinding the frames and stack
+// to where the handler was set up and pushing the caught value for it. It
+// reports whether there was a handler to take the error. None takes an
+// Exit.
+func (vm *VM) catch(err error) bool {
+	if _, exit := object.ExitCode(err); exit || len(vm.handlers) == 0 {
+		return false
+	}
+	h := vm.handlers[len(vm.handlers)-1]
+	vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+	e, ok := err.(*object.Error)
+	if !ok {
+		e = object.NewError(object.RuntimeError, "%s", err)
+	}
+	vm.framesIndex = h.framesIndex
+	vm.sp = h.sp
+	vm.push(e.Caught())
+	vm.currentFrame().ip = h.catchIP - 1
+	return true
+}
+
+func (vm *VM) executeExceptionIndex(exception, index object.Object) error {
+	ex := exception.(*object.Exception)
+	switch index.(*object.String).Value {
+	case "kind":
+		return vm.push(&object.String{Value: ex.Kind})
+	case "message":
+		return vm.push(&object.String{Value: ex.Message})
+	default:
+		return vm.push(Null)
+	}
+}
@@ -1,7 +1,6 @@
 package vm
 
 import (
-	"fmt"
 	"waiacig/code"
 	"waiacig/compiler"
 	"waiacig/object"
@@ -18,16 +17,24 @@ type VM struct {
 	globals     []object.Object
 	frames      []*Frame
 	framesIndex int
+	handlers    []handler
+	yielded     object.Object // set by OpYield when running a generator
+	modules     Modules
+	host        *object.Host
 }
 
-var True = &object.Boolean{Value: true}
-var False = &object.Boolean{Value: false}
-var Null = &object.Null{}
+var True = object.TRUE
+var False = object.FALSE
+var Null = object.NULL
 
 func NewVM(bytecode *compiler.Bytecode) *VM {
 
-	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
-	mainClosure := &object.Closure{Fn: mainFn}
+	globals := make([]object.Object, GlobalsSize)
+	mainFn := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		NumLocals:    bytecode.NumLocals,
+	}
+	mainClosure := &object.Closure{Fn: mainFn, Globals: globals}
 	mainFrame := NewFrame(mainClosure, 0)
 
 	frames := make([]*Frame, MaxFrames)
@@ -36,14 +43,27 @@ func NewVM(bytecode *compiler.Bytecode) *VM {
 	return &VM{
 		constants:   bytecode.Constants,
 		stack:       make([]object.Object, StackSize),
-		sp:          0,
-		globals:     make([]object.Object, GlobalsSize),
+		sp:          bytecode.NumLocals,
+		globals:     globals,
 		frames:      frames,
 		framesIndex: 1,
+		modules:     Modules{},
 	}
 }
 
+// Run executes the bytecode. An error raised while a handler is set up is
+// caught by it and execution carries on from there; any other error stops
+// the VM and is returned.
 func (vm *VM) Run() error {
+	for {
+		err := vm.run()
+		if err == nil || !vm.catch(err) {
+			return err
+		}
+	}
+}
+
+func (vm *VM) run() error {
 
 	var ip int
 	var ins code.Instructions
@@ -66,11 +86,11 @@ func (vm *VM) Run() error {
 		case code.OpSetGlobal:
 			globalIndex := code.ReadUint16(ins[ip+1:])
 			vm.currentFrame().ip += 2
-			vm.globals[globalIndex] = vm.pop()
+			vm.currentFrame().cl.Globals[globalIndex] = vm.pop()
 		case code.OpGetGlobal:
 			globalIndex := code.ReadUint16(ins[ip+1:])
 			vm.currentFrame().ip += 2
-			err := vm.push(vm.globals[globalIndex])
+			err := vm.push(vm.currentFrame().cl.Globals[globalIndex])
 			if err != nil {
 				return err
 			}
@@ -162,10 +182,104 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case code.OpMethod:
+			name := vm.pop()
+			receiver := vm.pop()
+			err := vm.executeMethod(receiver, name.(*object.String).Value)
+			if err != nil {
+				return err
+			}
+		case code.OpSlice:
+			step := vm.pop()
+			end := vm.pop()
+			start := vm.pop()
+			left := vm.pop()
+			err := vm.pushResult(object.Slice(left, start, end, step))
+			if err != nil {
+				return err
+			}
+		case code.OpSetIndex:
+			value := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+			err := vm.pushResult(object.SetIndex(left, index, value))
+			if err != nil {
+				return err
+			}
+		case code.OpRange:
+			end := vm.pop()
+			start := vm.pop()
+			err := vm.pushResult(object.NewRange(start, end))
+			if err != nil {
+				return err
+			}
+		case code.OpImport:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			err := vm.executeImport(int(constIndex))
+			if err != nil {
+				return err
+			}
 		case code.OpCall:
 			numArgs := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
-			err := vm.executeCall(int(numArgs))
+			err := vm.executeCall(int(numArgs), nil)
+			if err != nil {
+				return err
+			}
+		case code.OpApply:
+			numKeywords := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			err := vm.executeApply(int(numKeywords), false)
+			if err != nil {
+				return err
+			}
+		case code.OpSpread:
+			err := vm.executeSpread()
+			if err != nil {
+				return err
+			}
+		case code.OpTry:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			vm.handlers = append(vm.handlers, handler{
+				framesIndex: vm.framesIndex,
+				catchIP:     pos,
+				sp:          vm.sp,
+			})
+		case code.OpEndTry:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+		case code.OpThrow:
+			return object.Throw(vm.pop())
+		case code.OpYield:
+			vm.yielded = vm.pop()
+			// The value of the yield expression once resumed.
+			err := vm.push(Null)
+			if err != nil {
+				return err
+			}
+			return nil
+		case code.OpSuspend:
+			return nil
+		case code.OpIterate:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			err := vm.executeIterate(pos)
+			if err != nil {
+				return err
+			}
+		case code.OpJumpIfBound:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			pos := int(code.ReadUint16(ins[ip+2:]))
+			vm.currentFrame().ip += 3
+			frame := vm.currentFrame()
+			if vm.stack[frame.basePointer+int(localIndex)] != nil {
+				frame.ip = pos - 1
+			}
+		case code.OpTailCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			err := vm.executeTailCall(int(numArgs), nil)
 			if err != nil {
 				return err
 			}
@@ -185,10 +299,13 @@ func (vm *VM) Run() error {
 				return err
 			}
 		case code.OpGetBuiltin:
-			builtinIndex := code.ReadUint8(ins[ip+1:])
-			vm.currentFrame().ip += 1
-			definition := object.Builtins[builtinIndex]
-			err := vm.push(definition.Builtin)
+			builtinIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			builtin := vm.host.Builtin(int(builtinIndex))
+			if builtin == nil {
+				return object.NewError(object.NameError, "no builtin with index %d", builtinIndex)
+			}
+			err := vm.push(builtin)
 			if err != nil {
 				return err
 			}
@@ -200,6 +317,55 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case code.OpMatchValue:
+			pattern := vm.pop()
+			value := vm.pop()
+			err := vm.push(nativeBoolToBooleanObject(matchesValue(value, pattern)))
+			if err != nil {
+				return err
+			}
+		case code.OpMatchArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			hasRest := code.ReadUint8(ins[ip+3:]) == 1
+			vm.currentFrame().ip += 3
+			array, ok := vm.pop().(*object.Array)
+			matched := ok && (len(array.Elements) == numElements ||
+				hasRest && len(array.Elements) > numElements)
+			err := vm.push(nativeBoolToBooleanObject(matched))
+			if err != nil {
+				return err
+			}
+		case code.OpMatchHash:
+			_, ok := vm.pop().(*object.Hash)
+			err := vm.push(nativeBoolToBooleanObject(ok))
+			if err != nil {
+				return err
+			}
+		case code.OpMatchKey:
+			key := vm.pop()
+			hash := vm.pop()
+			err := vm.push(nativeBoolToBooleanObject(hasKey(hash, key)))
+			if err != nil {
+				return err
+			}
+		case code.OpArrayRest:
+			start := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			array := vm.pop().(*object.Array)
+			rest := make([]object.Object, len(array.Elements)-start)
+			copy(rest, array.Elements[start:])
+			err := vm.push(&object.Array{Elements: rest})
+			if err != nil {
+				return err
+			}
+		case code.OpNoMatch:
+			return object.NewError(object.MatchError,
+				"no match arm for value: %s", vm.pop().Inspect())
+		case code.OpDestructureError:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			return object.NewError(object.MatchError, "cannot destructure %s into %s",
+				vm.pop().Inspect(), vm.constants[constIndex].Inspect())
 		case code.OpGetFree:
 			freeIndex := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
@@ -208,6 +374,31 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case code.OpPatchFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			value := vm.pop()
+			closure := vm.pop().(*object.Closure)
+			closure.Free[freeIndex] = value
+		case code.OpUnset:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			name := vm.constants[constIndex].(*object.String).Value
+			err := vm.push(&unset{name: name})
+			if err != nil {
+				return err
+			}
+		case code.OpCheckSet:
+			if u, ok := vm.stack[vm.sp-1].(*unset); ok {
+				return object.NewError(object.NameError, "identifier not found: %s", u.name)
+			}
+		case code.OpTailApply:
+			numKeywords := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			err := vm.executeApply(int(numKeywords), true)
+			if err != nil {
+				return err
+			}
 		}
 	}
 	return nil
@@ -217,7 +408,7 @@ func (vm *VM) pushClosure(constIndex int, numFree int) error {
 	constant := vm.constants[constIndex]
 	function, ok := constant.(*object.CompiledFunction)
 	if !ok {
-		return fmt.Errorf("not a function: %+v", constant)
+		return object.NewError(object.TypeError, "not a function: %+v", constant)
 	}
 
 	free := make([]object.Object, numFree)
@@ -226,37 +417,79 @@ func (vm *VM) pushClosure(constIndex int, numFree int) error {
 	}
 	vm.sp = vm.sp - numFree
 
-	closure := &object.Closure{Fn: function, Free: free}
+	closure := &object.Closure{Fn: function, Free: free, Globals: vm.currentFrame().cl.Globals}
 	return vm.push(closure)
 }
 
-func (vm *VM) executeCall(numArgs int) error {
+func (vm *VM) executeCall(numArgs int, keywords []keywordArgument) error {
 	callee := vm.stack[vm.sp-1-numArgs]
 	switch callee := callee.(type) {
 	case *object.Closure:
-		return vm.callClosure(callee, numArgs)
+		return vm.callClosure(callee, numArgs, keywords)
 	case *object.Builtin:
+		if len(keywords) > 0 {
+			return object.NewError(object.ArityError,
+				"keyword arguments not supported by builtin functions")
+		}
 		return vm.callBuiltin(callee, numArgs)
+	case *unbound:
+		return vm.callUnbound(callee, numArgs, keywords)
 	default:
-		return fmt.Errorf("calling non-function and non-built-in")
+		return object.NewError(object.TypeError, "calling non-function and non-built-in")
+	}
+}
+
+func (vm *VM) callClosure(cl *object.Closure, numArgs int, keywords []keywordArgument) error {
+	if vm.framesIndex >= MaxFrames {
+		return object.NewError(object.RuntimeError, "stack overflow")
+	}
+	basePointer := vm.sp - numArgs
+	if basePointer+cl.Fn.NumLocals >= StackSize {
+		return object.NewError(object.RuntimeError, "stack overflow")
+	}
+	err := vm.bindArguments(cl.Fn, basePointer, numArgs, keywords)
+	if err != nil {
+		return err
 	}
+	if cl.Fn.Generator {
+		return vm.startGenerator(cl, basePointer)
+	}
+	vm.pushFrame(NewFrame(cl, basePointer))
+	vm.sp = basePointer + cl.Fn.NumLocals
+	return nil
 }
 
-func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
-	if numArgs != cl.Fn.NumParameters {
-		return fmt.Errorf("wrong number of arguments: want=%d, got=%d",
-			cl.Fn.NumParameters, numArgs)
+// executeTailCall calls a closure in place of the current frame: the callee
+// and its arguments are moved down over the current callee and locals, and
+// the frame is reset to run the new closure from the start.
+func (vm *VM) executeTailCall(numArgs int, keywords []keywordArgument) error {
+	cl, ok := vm.stack[vm.sp-1-numArgs].(*object.Closure)
+	if !ok || cl.Fn.Generator {
+		return vm.executeCall(numArgs, keywords)
 	}
-	frame := NewFrame(cl, vm.sp-numArgs)
-	vm.pushFrame(frame)
+	basePointer := vm.sp - numArgs
+	if basePointer+cl.Fn.NumLocals >= StackSize {
+		return object.NewError(object.RuntimeError, "stack overflow")
+	}
+	err := vm.bindArguments(cl.Fn, basePointer, numArgs, keywords)
+	if err != nil {
+		return err
+	}
+	frame := vm.currentFrame()
+	copy(vm.stack[frame.basePointer-1:], vm.stack[basePointer-1:vm.sp])
+	frame.cl = cl
+	frame.ip = -1
 	vm.sp = frame.basePointer + cl.Fn.NumLocals
 	return nil
 }
 
 func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
 	args := vm.stack[vm.sp-numArgs : vm.sp]
-	result := builtin.Fn(args...)
+	result := builtin.Call(vm, args...)
 	vm.sp = vm.sp - numArgs - 1
+	if err, ok := result.(*object.Error); ok {
+		return err
+	}
 	if result != nil {
 		vm.push(result)
 	} else {
@@ -266,37 +499,50 @@ func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
 }
 
 func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
-	hashedPairs := make(map[object.HashKey]object.HashPair)
+	hash := object.NewHash()
 	for i := startIndex; i < endIndex; i += 2 {
 		key := vm.stack[i]
 		value := vm.stack[i+1]
 		pair := object.HashPair{Key: key, Value: value}
 		hashKey, ok := key.(object.Hashable)
 		if !ok {
-			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+			return nil, object.NewError(object.TypeError, "unusable as hash key: %s", key.Type())
 		}
-		hashedPairs[hashKey.HashKey()] = pair
+		hash.Set(hashKey.HashKey(), pair)
 	}
-	return &object.Hash{Pairs: hashedPairs}, nil
+	return hash, nil
 }
 
 func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
-	elements := make([]object.Object, endIndex-startIndex)
+	elements := make([]object.Object, 0, endIndex-startIndex)
 	for i := startIndex; i < endIndex; i++ {
-		elements[i-startIndex] = vm.stack[i]
+		if s, ok := vm.stack[i].(*spread); ok {
+			elements = append(elements, s.elements...)
+			continue
+		}
+		elements = append(elements, vm.stack[i])
 	}
 	return &object.Array{Elements: elements}
 }
 
 func (vm *VM) push(o object.Object) error {
 	if vm.sp >= StackSize {
-		return fmt.Errorf("stack overflow")
+		return object.NewError(object.RuntimeError, "stack overflow")
 	}
 	vm.stack[vm.sp] = o
 	vm.sp++
 	return nil
 }
 
+// pushResult pushes the result of an operation shared with the evaluator,
+// or returns it if it's an error.
+func (vm *VM) pushResult(result object.Object) error {
+	if err, ok := result.(*object.Error); ok {
+		return err
+	}
+	return vm.push(result)
+}
+
 func (vm *VM) pop() object.Object {
 	o := vm.stack[vm.sp-1]
 	vm.sp--
@@ -336,17 +582,29 @@ func (vm *VM) executeBinaryOperation(op code.Opcode) error {
 	case leftType == object.STRING_OBJ && rightType == object.STRING_OBJ:
 		return vm.executeBinaryStringOperation(op, left, right)
 	default:
-		return fmt.Errorf("unsupported types for binary operation: %s %s",
-			leftType, rightType)
+		return object.NewInfixError(left, infixOperators[op], right)
 	}
 }
 
+// infixOperators names the operators of the opcodes for binary operations
+// and comparisons, for errors. As 'a < b' is compiled to 'b > a', its
+// errors name '>' and its operands the other way around.
+var infixOperators = map[code.Opcode]string{
+	code.OpAdd:         "+",
+	code.OpSub:         "-",
+	code.OpMul:         "*",
+	code.OpDiv:         "/",
+	code.OpEqual:       "==",
+	code.OpNotEqual:    "!=",
+	code.OpGreaterThan: ">",
+}
+
 func (vm *VM) executeBinaryStringOperation(
 	op code.Opcode,
 	left, right object.Object,
 ) error {
 	if op != code.OpAdd {
-		return fmt.Errorf("unknown string operator: %d", op)
+		return object.NewInfixError(left, infixOperators[op], right)
 	}
 	leftValue := left.(*object.String).Value
 	rightValue := right.(*object.String).Value
@@ -370,7 +628,7 @@ func (vm *VM) executeBinaryIntegerOperation(
 	case code.OpDiv:
 		result = leftValue / rightValue
 	default:
-		return fmt.Errorf("unknown integer operator: %d", op)
+		return object.NewError(object.TypeError, "unknown integer operator: %d", op)
 	}
 	return vm.push(&object.Integer{Value: result})
 }
@@ -378,16 +636,19 @@ func (vm *VM) executeBinaryIntegerOperation(
 func (vm *VM) executeComparison(op code.Opcode) error {
 	right := vm.pop()
 	left := vm.pop()
-	if left.Type() == object.INTEGER_OBJ || right.Type() == object.INTEGER_OBJ {
+	if left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ {
 		return vm.executeIntegerComparison(op, left, right)
 	}
+	if left.Type() == object.REGEX_OBJ && right.Type() == object.REGEX_OBJ {
+		return vm.executeRegexComparison(op, left, right)
+	}
 	switch op {
 	case code.OpEqual:
 		return vm.push(nativeBoolToBooleanObject(right == left))
 	case code.OpNotEqual:
 		return vm.push(nativeBoolToBooleanObject(right != left))
 	default:
-		return fmt.Errorf("unknown operator: %d (%s %s)", op, left.Type(), right.Type())
+		return object.NewInfixError(left, infixOperators[op], right)
 	}
 }
 
@@ -403,7 +664,23 @@ func (vm *VM) executeIntegerComparison(op code.Opcode,
 	case code.OpGreaterThan:
 		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
 	default:
-		return fmt.Errorf("unknown operator: %d", op)
+		return object.NewError(object.TypeError, "unknown operator: %d", op)
+	}
+}
+
+// executeRegexComparison compares regexes by their patterns, like the
+// evaluator, which creates a new regex for each evaluation of a literal.
+func (vm *VM) executeRegexComparison(op code.Opcode,
+	left, right object.Object) error {
+	leftValue := left.(*object.Regex).Regexp.String()
+	rightValue := right.(*object.Regex).Regexp.String()
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(rightValue == leftValue))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(rightValue != leftValue))
+	default:
+		return object.NewInfixError(left, infixOperators[op], right)
 	}
 }
 
@@ -431,27 +708,109 @@ func (vm *VM) executeBangOperator() error {
 func (vm *VM) executeMinusOperator() error {
 	operand := vm.pop()
 	if operand.Type() != object.INTEGER_OBJ {
-		return fmt.Errorf("unsupported type for negation: %s", operand.Type())
+		return object.NewPrefixError("-", operand)
 	}
 	value := operand.(*object.Integer).Value
 	return vm.push(&object.Integer{Value: -value})
 }
 
+// unset is the value of a variable bound by a let that functions declared
+// before it can see, until the let runs. OpCheckSet makes reading it an
+// error, as it is in the evaluator.
+type unset struct {
+	name string
+}
+
+func (u *unset) Type() object.ObjectType { return "UNSET" }
+func (u *unset) Inspect() string         { return u.name }
+
 func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
 	vm := NewVM(bytecode)
 	vm.globals = s
+	vm.frames[0].cl.Globals = s
 	return vm
 }
 
+// matchesValue reports whether value equals the literal pattern, comparing
+// by type and content rather than by identity.
+func matchesValue(value, pattern object.Object) bool {
+	v, ok := value.(object.Hashable)
+	if !ok {
+		return false
+	}
+	p, ok := pattern.(object.Hashable)
+	return ok && v.HashKey() == p.HashKey()
+}
+
+func hasKey(hash, key object.Object) bool {
+	hashObject, ok := hash.(*object.Hash)
+	if !ok {
+		return false
+	}
+	hashKey, ok := key.(object.Hashable)
+	if !ok {
+		return false
+	}
+	_, ok = hashObject.Pairs[hashKey.HashKey()]
+	return ok
+}
+
 func (vm *VM) executeIndexExpression(left, index object.Object) error {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return vm.executeArrayIndex(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return vm.executeHashIndex(left, index)
+	case left.Type() == object.EXCEPTION_OBJ && index.Type() == object.STRING_OBJ:
+		return vm.executeExceptionIndex(left, index)
+	case left.Type() == object.RANGE_OBJ && index.Type() == object.INTEGER_OBJ:
+		value, ok := left.(*object.Range).Index(index.(*object.Integer).Value)
+		if !ok {
+			return vm.push(Null)
+		}
+		return vm.push(&object.Integer{Value: value})
+	case left.Type() == object.MODULE_OBJ && index.Type() == object.STRING_OBJ:
+		export := left.(*object.Module).Member(index.(*object.String).Value)
+		if err, ok := export.(*object.Error); ok {
+			return err
+		}
+		return vm.push(export)
 	default:
-		return fmt.Errorf("index operator not supported: %s", left.Type())
+		return object.NewError(object.TypeError, "index operator not supported: %s", left.Type())
+	}
+}
+
+// executeMethod pushes the method called by 'receiver.name(...)' followed by
+// the receiver, its first argument. A hash's own field is used if it has one,
+// otherwise the builtin with that name. A module's export is marked to be
+// called without the module.
+func (vm *VM) executeMethod(receiver object.Object, name string) error {
+	var method object.Object
+	if module, ok := receiver.(*object.Module); ok {
+		export := module.Member(name)
+		if err, ok := export.(*object.Error); ok {
+			return err
+		}
+		method = &unbound{fn: export}
+	}
+	if hash, ok := receiver.(*object.Hash); ok {
+		key := &object.String{Value: name}
+		if pair, ok := hash.Pairs[key.HashKey()]; ok {
+			method = pair.Value
+		}
+	}
+	if method == nil {
+		builtin := vm.host.Lookup(name)
+		if builtin == nil {
+			return object.NewError(object.NameError, "undefined method %s for %s", name, receiver.Type())
+		}
+		method = builtin
+	}
+	err := vm.push(method)
+	if err != nil {
+		return err
 	}
+	return vm.push(receiver)
 }
 
 func (vm *VM) executeArrayIndex(array, index object.Object) error {
@@ -468,7 +827,7 @@ func (vm *VM) executeHashIndex(hash, index object.Object) error {
 	hashObject := hash.(*object.Hash)
 	key, ok := index.(object.Hashable)
 	if !ok {
-		return fmt.Errorf("unusable as hash key: %s", index.Type())
+		return object.NewError(object.TypeError, "unusable as hash key: %s", index.Type())
 	}
 	pair, ok := hashObject.Pairs[key.HashKey()]
 	if !ok {